@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"fxgo"
+	"fxlex"
+	"fxopt"
+	"fxparser"
+	"os"
+)
+
+//fx2go translates an fx program to a Go package
+//	fx2go -file lang.fx -pkg lang -out lang.go
+
+func main() {
+
+	filename := flag.String("file", "", "fx program to translate")
+	pkg := flag.String("pkg", "fx", "name of the Go package")
+	out := flag.String("out", "", "Go file to write, the standard output if empty")
+	flag.Parse()
+	if *filename == "" {
+		fmt.Println("Error: at least argument -file is necessary.")
+		os.Exit(1)
+	}
+
+	if err := run(*filename, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filename, pkg, out string) error {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p := fxparser.NewParser(fxlex.NewLexer(bufio.NewReader(file), filename))
+	p.DebugDesc = false
+	//the standard output is for the Go code
+	p.Diag = os.Stderr
+	prog, errs := p.Parse()
+	if errs != nil {
+		return fmt.Errorf("%s: %d errors", filename, len(errs))
+	}
+	//constant errors, like dividing by 0, are found before translating
+	if errs := fxopt.Fold(prog); errs != nil {
+		return errors.Join(errs...)
+	}
+	src, err := fxgo.Generate(prog, pkg)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0644)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"fxinterp"
+	"fxpng"
+	"image/color"
+	"os"
+)
+
+//fx2png runs an fx program and writes what it draws as a PNG
+//	fx2png -file lang.fx -width 512 -height 512 -out out.png
+
+func main() {
+
+	filename := flag.String("file", "", "fx program to run")
+	width := flag.Int("width", 512, "width of the image")
+	height := flag.Int("height", 512, "height of the image")
+	out := flag.String("out", "out.png", "PNG file to write")
+	flag.Parse()
+	if *filename == "" {
+		fmt.Println("Error: at least argument -file is necessary.")
+		os.Exit(1)
+	}
+
+	if err := run(*filename, *out, *width, *height); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filename, out string, width, height int) error {
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	canvas := fxpng.New(width, height, color.White)
+	if err := fxinterp.Run(context.Background(), src, filename, canvas); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := canvas.Encode(dst); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
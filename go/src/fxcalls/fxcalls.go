@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"fxlex"
+	"fxparser"
+	"os"
+)
+
+//fxcalls checks the call graph of an fx program: recursion, funcs
+//unreachable from main and a missing or repeated main. With -dot it
+//writes the graph in the Graphviz DOT language
+//	fxcalls -file lang.fx -dot lang.dot
+
+func main() {
+
+	filename := flag.String("file", "", "fx program to check")
+	dot := flag.String("dot", "", "DOT file to write, - for the standard output")
+	flag.Parse()
+	if *filename == "" {
+		fmt.Println("Error: at least argument -file is necessary.")
+		os.Exit(1)
+	}
+
+	if err := run(*filename, *dot); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filename, dot string) error {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p := fxparser.NewParser(fxlex.NewLexer(bufio.NewReader(file), filename))
+	p.DebugDesc = false
+	//the standard output is for the graph
+	p.Diag = os.Stderr
+	//the graph is built even if the program has errors
+	prog, _ := p.Parse()
+	g := fxparser.NewCallGraph(prog)
+
+	switch dot {
+	case "":
+	case "-":
+		err = g.WriteDot(os.Stdout)
+	default:
+		var out *os.File
+		if out, err = os.Create(dot); err == nil {
+			err = g.WriteDot(out)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	errs := g.Errors()
+	for _, e := range errs {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	if errs != nil {
+		return fmt.Errorf("%s: %d errors in the call graph", filename, len(errs))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package fxcanvas
+
+import (
+	"fmt"
+	"image/color"
+)
+
+//Canvas is where an fx program draws, every call to the builtins circle
+//and rect is a call to the methods of the canvas.
+type Canvas interface {
+	//Circle draws a filled circle
+	Circle(center Point, radius int64, color Color)
+	//Rect draws a RectSize square with a corner at corner, rotated
+	//angle degrees clockwise around it (y grows downwards)
+	Rect(corner Point, angle int64, color Color)
+}
+
+//Grouper is implemented by the canvases that group what is drawn by
+//every call to a user func. Begin is called when the func starts and
+//End when it returns, they nest like the calls.
+type Grouper interface {
+	Begin(name string)
+	End(name string)
+}
+
+//RectSize is the side of the squares drawn by rect, fx gives no size
+const RectSize = 10
+
+//Point is the value of an fx Coord
+type Point struct {
+	X, Y int64
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("[%d, %d]", p.X, p.Y)
+}
+
+//Color is 0xTTRRGGBB, TT is the transparency, 0 is opaque
+type Color uint32
+
+func (c Color) String() string {
+	return fmt.Sprintf("0x%08x", uint32(c))
+}
+
+//NRGBA decodes the color, the alpha is 0xff minus the transparency
+func (c Color) NRGBA() color.NRGBA {
+	return color.NRGBA{
+		R: uint8(c >> 16),
+		G: uint8(c >> 8),
+		B: uint8(c),
+		A: 0xff - uint8(c>>24),
+	}
+}
+
+//Cmd is a call to a method of a Canvas
+type Cmd struct {
+	Name  string //circle or rect
+	P     Point
+	N     int64 //radius or angle
+	Color Color
+}
+
+func (c Cmd) String() string {
+	return fmt.Sprintf("%s(%s, %d, %s)", c.Name, c.P, c.N, c.Color)
+}
+
+//Recorder is a Canvas that keeps the calls in Cmds
+type Recorder struct {
+	Cmds []Cmd
+}
+
+func (r *Recorder) Circle(center Point, radius int64, color Color) {
+	r.Cmds = append(r.Cmds, Cmd{Name: "circle", P: center, N: radius, Color: color})
+}
+
+func (r *Recorder) Rect(corner Point, angle int64, color Color) {
+	r.Cmds = append(r.Cmds, Cmd{Name: "rect", P: corner, N: angle, Color: color})
+}
+
+//Strings returns the calls as strings, circle([4, 45], 2, 0x000000ff)
+func (r *Recorder) Strings() []string {
+	s := []string{}
+	for _, c := range r.Cmds {
+		s = append(s, c.String())
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package fxcanvas_test
+
+import (
+	. "fxcanvas"
+	"image/color"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+
+	var c Canvas = &Recorder{}
+	c.Circle(Point{4, 45}, 2, 0x1100001f)
+	c.Rect(Point{-1, 0}, 90, 0xff)
+
+	rec := c.(*Recorder)
+	wanted := []string{"circle([4, 45], 2, 0x1100001f)", "rect([-1, 0], 90, 0x000000ff)"}
+	got := rec.Strings()
+	if len(got) != len(wanted) {
+		t.Fatalf("recorded %v", got)
+	}
+	for i := range wanted {
+		if got[i] != wanted[i] {
+			t.Errorf("recorded %s, should be %s", got[i], wanted[i])
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+
+	tests := []struct {
+		c    Color
+		want color.NRGBA
+	}{
+		{0x00ff0000, color.NRGBA{R: 0xff, A: 0xff}},
+		{0x1100001f, color.NRGBA{B: 0x1f, A: 0xee}},
+		{0xff123456, color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0}},
+	}
+	for _, test := range tests {
+		if got := test.c.NRGBA(); got != test.want {
+			t.Errorf("%s is %v, should be %v", test.c, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package fxgo
+
+import (
+	"bytes"
+	"fmt"
+	"fxlex"
+	"fxparser"
+	"fxsym"
+	"go/format"
+	"go/token"
+	"strings"
+)
+
+//Generate translates a program without errors, as returned by
+//fxparser.Parse, to the source of the Go package pkg. The package only
+//imports fxcanvas:
+//	Coord and the records are structs, copied by value like in fx
+//	every func takes the canvas it draws on as its first parameter
+//	main is main_ and Main calls it, if main has no parameters
+//	iter is a for loop, the bound is included and with a negative step
+//	it counts down, it ends when the next value would overflow
+//	/ and % are div and mod, Go does not compile a division by a
+//	constant 0
+//	| and & are or and and, fx evaluates both operands
+//Errors at run time (division by zero, negative exponent, iter step 0)
+//are panics.
+//
+//Names that Go does not accept or that the generated code uses get a _
+//at the end, as well as the names that already end in _, so the names
+//of the generated code never clash with the ones of the program.
+
+var reserved = map[string]bool{
+	"Coord":    true,
+	"Main":     true,
+	"main":     true,
+	"init":     true,
+	"canvas":   true,
+	"fxcanvas": true,
+	"int64":    true,
+	"bool":     true,
+	"true":     true,
+	"false":    true,
+	"panic":    true,
+	"pow":      true,
+	"div":      true,
+	"mod":      true,
+	"and":      true,
+	"or":       true,
+	"color":    true,
+	"point":    true,
+	"iterStep": true,
+}
+
+//goName returns the Go name of an fx name
+func goName(name string) string {
+
+	if token.IsKeyword(name) || reserved[name] || strings.HasSuffix(name, "_") {
+		return name + "_"
+	}
+	if !token.IsIdentifier(name) {
+		return fmt.Sprintf("u%x_", name)
+	}
+	return name
+}
+
+func goType(t *fxsym.Type) string {
+
+	switch t.Kind {
+	case fxsym.TInt:
+		return "int64"
+	case fxsym.TBool:
+		return "bool"
+	case fxsym.TCoord:
+		return "Coord"
+	}
+	return goName(t.Name)
+}
+
+const header = `// Code generated by fxgo from %s. DO NOT EDIT.
+
+package %s
+
+import "fxcanvas"
+
+// Coord is the fx Coord
+type Coord struct {
+	x, y int64
+}
+
+func (p Coord) point() fxcanvas.Point {
+	return fxcanvas.Point{X: p.x, Y: p.y}
+}
+
+func color(c int64) fxcanvas.Color {
+	return fxcanvas.Color(c)
+}
+
+func pow(a, b int64) int64 {
+	if b < 0 {
+		panic("negative exponent")
+	}
+	r := int64(1)
+	for ; b > 0; b >>= 1 {
+		if b&1 == 1 {
+			r *= a
+		}
+		a *= a
+	}
+	return r
+}
+
+func div(a, b int64) int64 {
+	if b == 0 {
+		panic("division by zero")
+	}
+	return a / b
+}
+
+func mod(a, b int64) int64 {
+	if b == 0 {
+		panic("division by zero")
+	}
+	return a %% b
+}
+
+func and(a, b bool) bool {
+	return a && b
+}
+
+func or(a, b bool) bool {
+	return a || b
+}
+
+func iterStep(s int64) int64 {
+	if s == 0 {
+		panic("iter step is 0")
+	}
+	return s
+}
+`
+
+type generator struct {
+	buf    bytes.Buffer
+	indent int
+}
+
+func (g *generator) line(format string, args ...interface{}) {
+	g.buf.WriteString(strings.Repeat("\t", g.indent))
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteString("\n")
+}
+
+func Generate(prog *fxparser.Program, pkg string) ([]byte, error) {
+
+	//Parse rejects recursion, a tree built some other way may still have it
+	if cycles := fxparser.NewCallGraph(prog).Cycles(); len(cycles) > 0 {
+		c := cycles[0]
+		return nil, fmt.Errorf("%s: Recursive call to %s in cycle %s", c.Call.Tok.Start, c.Call.Name, c)
+	}
+
+	g := &generator{}
+	fmt.Fprintf(&g.buf, header, prog.Tok.File, pkg)
+
+	for _, rec := range prog.Records {
+		g.line("")
+		g.line("type %s struct {", goName(rec.Name))
+		for _, f := range rec.Sym.Type.Fields {
+			g.line("\t%s %s", goName(f.Name), goType(f.Type))
+		}
+		g.line("}")
+	}
+
+	if main := prog.Func("main"); main != nil && len(main.Params) == 0 {
+		g.line("")
+		g.line("// Main runs the fx program drawing on canvas")
+		g.line("func Main(canvas fxcanvas.Canvas) {")
+		g.line("\tmain_(canvas)")
+		g.line("}")
+	}
+
+	for _, fn := range prog.Funcs {
+		params := []string{"canvas fxcanvas.Canvas"}
+		for _, p := range fn.Params {
+			params = append(params, goName(p.Name)+" "+goType(p.Sym.Type))
+		}
+		g.line("")
+		g.line("func %s(%s) {", goName(fn.Name), strings.Join(params, ", "))
+		g.block(fn.Body)
+		g.line("}")
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return g.buf.Bytes(), fmt.Errorf("%s: generated bad Go: %v", prog.Tok.File, err)
+	}
+	return src, nil
+}
+
+func (g *generator) block(block *fxparser.Block) {
+	g.indent++
+	for _, stmt := range block.Stmts {
+		g.stmt(stmt)
+	}
+	g.indent--
+}
+
+func (g *generator) stmt(stmt fxparser.Stmt) {
+
+	switch stmt := stmt.(type) {
+	case *fxparser.VarDecl:
+		//the variable may be assigned and never read, Go does not allow it
+		name := goName(stmt.Name)
+		g.line("var %s %s", name, goType(stmt.Sym.Type))
+		g.line("_ = %s", name)
+	case *fxparser.AssignStmt:
+		g.line("%s = %s", g.expr(stmt.Target), g.expr(stmt.Value))
+	case *fxparser.CallStmt:
+		args := []string{}
+		for _, a := range stmt.Args {
+			args = append(args, g.expr(a))
+		}
+		if stmt.Sym.Kind == fxsym.SBuiltin {
+			method := strings.ToUpper(stmt.Name[:1]) + stmt.Name[1:]
+			g.line("canvas.%s(%s.point(), %s, color(%s))", method, args[0], args[1], args[2])
+			return
+		}
+		g.line("%s(%s)", goName(stmt.Name), strings.Join(append([]string{"canvas"}, args...), ", "))
+	case *fxparser.IterStmt:
+		i := goName(stmt.Var.Name)
+		//end_, step_ and next_ are not the Go name of any fx name
+		g.line("for %s, end_, step_ := int64(%s), int64(%s), iterStep(%s); step_ > 0 && %s <= end_ || step_ < 0 && %s >= end_; {",
+			i, g.expr(stmt.Start), g.expr(stmt.End), g.expr(stmt.Step), i, i)
+		g.block(stmt.Body)
+		//like in the interpreter, the loop ends on overflow
+		g.line("\tif next_ := %s + step_; (step_ > 0) == (next_ > %s) {", i, i)
+		g.line("\t\t%s = next_", i)
+		g.line("\t} else {")
+		g.line("\t\tbreak")
+		g.line("\t}")
+		g.line("}")
+	case *fxparser.IfStmt:
+		g.line("if %s {", g.expr(stmt.Cond))
+		g.ifEnd(stmt)
+	case *fxparser.Block:
+		g.line("{")
+		g.block(stmt)
+		g.line("}")
+	}
+}
+
+//ifEnd writes the then block and the else of an if, else if is
+//written in the same line as the }
+func (g *generator) ifEnd(stmt *fxparser.IfStmt) {
+
+	g.block(stmt.Then)
+	switch els := stmt.Else.(type) {
+	case nil:
+		g.line("}")
+	case *fxparser.IfStmt:
+		g.line("} else if %s {", g.expr(els.Cond))
+		g.ifEnd(els)
+	case *fxparser.Block:
+		g.line("} else {")
+		g.block(els)
+		g.line("}")
+	}
+}
+
+//the Go operator and its precedence, ^ of bools is !=. ** / % | and &
+//are calls.
+var binOps = map[fxlex.TokType]struct {
+	op   string
+	prec int
+}{
+	fxlex.TokType('^'): {"!=", 3},
+	fxlex.TokEqual:     {"==", 3},
+	fxlex.TokType('<'): {"<", 3},
+	fxlex.TokType('>'): {">", 3},
+	fxlex.TokSmaller:   {"<=", 3},
+	fxlex.TokGreater:   {">=", 3},
+	fxlex.TokType('+'): {"+", 4},
+	fxlex.TokType('-'): {"-", 4},
+	fxlex.TokType('*'): {"*", 5},
+}
+
+//calls are the operators written as calls to the funcs of the header
+var calls = map[fxlex.TokType]string{
+	fxlex.TokDMul:      "pow",
+	fxlex.TokType('/'): "div",
+	fxlex.TokType('%'): "mod",
+	fxlex.TokType('|'): "or",
+	fxlex.TokType('&'): "and",
+}
+
+func isCall(e fxparser.Expr) bool {
+	b, ok := e.(*fxparser.BinaryExpr)
+	return ok && calls[b.Op] != ""
+}
+
+//operand returns the Go for an operand of a binary operator of
+//precedence prec, in parenthesis if it would group in other way
+func (g *generator) operand(e fxparser.Expr, prec int, right bool) string {
+
+	s := g.expr(e)
+	b, ok := e.(*fxparser.BinaryExpr)
+	if !ok || isCall(b) {
+		return s
+	}
+	//comparisons do not chain, a == b == c is (a == b) == c
+	p := binOps[b.Op].prec
+	if p < prec || (p == prec && (right || p == 3)) {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func (g *generator) expr(expr fxparser.Expr) string {
+
+	switch expr := expr.(type) {
+	case *fxparser.IntLit:
+		return fmt.Sprint(expr.Value)
+	case *fxparser.BoolLit:
+		return fmt.Sprint(expr.Value)
+	case *fxparser.Ident:
+		return goName(expr.Name)
+	case *fxparser.CoordLit:
+		return fmt.Sprintf("Coord{%s, %s}", g.expr(expr.X), g.expr(expr.Y))
+	case *fxparser.SelectorExpr:
+		//X is a variable, a selector or a Coord literal
+		return g.expr(expr.X) + "." + goName(expr.Sel.Name)
+	case *fxparser.UnaryExpr:
+		x := g.expr(expr.X)
+		switch expr.X.(type) {
+		case *fxparser.UnaryExpr:
+			x = "(" + x + ")"
+		case *fxparser.BinaryExpr:
+			if !isCall(expr.X) {
+				x = "(" + x + ")"
+			}
+		}
+		return string(rune(expr.Op)) + x
+	case *fxparser.BinaryExpr:
+		if call := calls[expr.Op]; call != "" {
+			return fmt.Sprintf("%s(%s, %s)", call, g.expr(expr.X), g.expr(expr.Y))
+		}
+		op := binOps[expr.Op]
+		return g.operand(expr.X, op.prec, false) + " " + op.op + " " + g.operand(expr.Y, op.prec, true)
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+package fxgo_test
+
+import (
+	"bytes"
+	"context"
+	"fxcanvas"
+	. "fxgo"
+	"fxinterp"
+	"fxparser"
+	"fxtest"
+	gobuild "go/build"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//text has what lang.fx does not: names that are not Go names, records
+//in records, else if and the precedence of the operators
+const text = "type record vector(int x, int y, int z)\n" +
+	"type record seg(Coord a, vector range)\n" +
+	"func move(seg s, int canvas){\n" +
+	"  s.a.x = 100;\n" +
+	"  canvas = 0;\n" +
+	"  circle(s.a, canvas, -1);\n" +
+	"}\n" +
+	"func main(){\n" +
+	"  vector v;\n" +
+	"  Coord pp;\n" +
+	"  seg s;\n" +
+	"  bool b;\n" +
+	"  int step_;\n" +
+	"  v.x = 3;\n" +
+	"  v.y = 8;\n" +
+	"  v.z = 2;\n" +
+	"  pp = [4,45];\n" +
+	"  s.range = v;\n" +
+	"  if(v.x > 3 | True) {\n" +
+	"    circle(pp, 2, 7);\n" +
+	"  } else if (!(v.x == 3) ^ b == False) {\n" +
+	"    move(s, v.z);\n" +
+	"  } else {\n" +
+	"    move(s, 7);\n" +
+	"  }\n" +
+	"  move(s, s.range.y);\n" +
+	"  iter (i := 5, -3, -3){\n" +
+	"    step_ = -(i - 1) * 2 ** 3 ** 1 / (4 - i % 3);\n" +
+	"    rect([s.a.x + i, [step_, 1].x], - -i, 0 - step_);\n" +
+	"  }\n" +
+	"}\n"
+
+func TestGofmt(t *testing.T) {
+
+	src, err := Generate(fxtest.Parse(t, "gen_test.fx", text), "fxgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := format.Source(src)
+	if err != nil || !bytes.Equal(formatted, src) {
+		t.Errorf("output is not gofmt clean: %v\n%s", err, src)
+	}
+	if !bytes.Contains(src, []byte("type seg struct {\n\ta      Coord\n\trange_ vector\n}")) {
+		t.Errorf("bad record struct:\n%s", src)
+	}
+}
+
+const mainSrc = `package main
+
+import (
+	"fmt"
+	"fxcanvas"
+	"fxgen"
+	"strings"
+)
+
+func main() {
+	rec := &fxcanvas.Recorder{}
+	fxgen.Main(rec)
+	fmt.Print(strings.Join(rec.Strings(), "\n"))
+}
+`
+
+//goRun builds the generated package with the go command and runs it,
+//it returns what it drew
+func goRun(t *testing.T, prog *fxparser.Program) (string, error) {
+
+	if testing.Short() {
+		t.Skip("builds with the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+
+	src, err := Generate(prog, "fxgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"src/fxgen/fxgen.go":    src,
+		"src/fxgenmain/main.go": []byte(mainSrc),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	build := exec.Command(goCmd, "build", "-o", filepath.Join(dir, "fxgenmain"), "fxgenmain")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOPATH="+dir+string(filepath.ListSeparator)+gobuild.Default.GOPATH, "GO111MODULE=off")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s\n%s", err, out, src)
+	}
+	out, err := exec.Command(filepath.Join(dir, "fxgenmain")).CombinedOutput()
+	return string(out), err
+}
+
+func interpDraw(t *testing.T, prog *fxparser.Program) (string, error) {
+
+	rec := &fxcanvas.Recorder{}
+	err := fxinterp.New(prog, rec).Run(context.Background())
+	return strings.Join(rec.Strings(), "\n"), err
+}
+
+//TestRun checks the generated package draws the same as the interpreter
+func TestRun(t *testing.T) {
+
+	for _, text := range []string{fxtest.Lang(t), text} {
+		prog := fxtest.Parse(t, "gen_test.fx", text)
+		out, err := goRun(t, prog)
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		want, err := interpDraw(t, prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("generated Go drew\n%s\ninterpreter drew\n%s", out, want)
+		}
+	}
+}
+
+//TestRunErrors checks the generated package builds with constant
+//divisors 0 and panics like the interpreter fails
+func TestRunErrors(t *testing.T) {
+
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"func main(){\n  int a;\n  a = 3;\n  a = a / 0;\n  circle([a, a], 1, 0);\n}\n", "division by zero"},
+		{"func main(){\n  int a;\n  a = 3;\n  a = a % (2 - 2);\n  circle([a, a], 1, 0);\n}\n", "division by zero"},
+		//| and & do not short-circuit
+		{"func main(){\n  int z;\n  z = 0;\n  if (False & 1 / z == 0) {\n    circle([z, z], 1, 0);\n  }\n}\n", "division by zero"},
+		{"func main(){\n  int z;\n  z = 0;\n  if (True | 1 % z == 0) {\n    circle([z, z], 1, 0);\n  }\n}\n", "division by zero"},
+	}
+	for _, test := range tests {
+		prog := fxtest.Parse(t, "gen_test.fx", test.text)
+		if _, err := interpDraw(t, prog); err == nil || !strings.HasSuffix(err.Error(), "Division by zero") {
+			t.Errorf("interpreter error is %v", err)
+		}
+		out, err := goRun(t, prog)
+		if err == nil || !strings.Contains(out, "panic: "+test.err) {
+			t.Errorf("generated Go ran with %v: %s", err, out)
+		}
+	}
+}
+
+//TestRecursion checks Generate refuses a cyclic tree that did not come
+//from Parse, the generated Go would recurse until the stack overflows
+func TestRecursion(t *testing.T) {
+
+	const text = "func f(){\n" +
+		"  g();\n" +
+		"}\n" +
+		"func g(){\n" +
+		"  circle([0, 0], 1, 1);\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  f();\n" +
+		"}\n"
+
+	//g calls itself with the call to g taken from f
+	prog := fxtest.Parse(t, "gen_test.fx", text)
+	g := prog.Func("g")
+	g.Body.Stmts = append(g.Body.Stmts, prog.Func("f").Body.Stmts[0])
+	_, err := Generate(prog, "fxgen")
+	if err == nil || err.Error() != "gen_test.fx:2:3: Recursive call to g in cycle g -> g" {
+		t.Errorf("expected a recursion error, got %v", err)
+	}
+}
+
+//TestIterOverflow checks the loops end like in the interpreter when
+//the next value would overflow
+func TestIterOverflow(t *testing.T) {
+
+	const text = "func main(){\n" +
+		"  iter (i := 9223372036854775805, 9223372036854775807, 2){\n" +
+		"    circle([0, 0], 1, i);\n" +
+		"  }\n" +
+		"  iter (i := -9223372036854775807 + 1, -9223372036854775807 - 1, -1){\n" +
+		"    circle([0, 0], 2, i);\n" +
+		"  }\n" +
+		"}\n"
+
+	prog := fxtest.Parse(t, "gen_test.fx", text)
+	want, err := interpDraw(t, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(want, "\n") + 1; n != 5 {
+		t.Fatalf("interpreter drew %d circles:\n%s", n, want)
+	}
+	out, err := goRun(t, prog)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if out != want {
+		t.Errorf("generated Go drew\n%s\ninterpreter drew\n%s", out, want)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"fxlex"
+	"fxopt"
+	"fxparser"
+	"os"
+)
+
+//fxinline writes an fx program with every func call inlined into main,
+//to see the builtin calls the macros expand to
+//	fxinline -file lang.fx
+
+func main() {
+
+	filename := flag.String("file", "", "fx program to expand")
+	flag.Parse()
+	if *filename == "" {
+		fmt.Println("Error: at least argument -file is necessary.")
+		os.Exit(1)
+	}
+
+	if err := run(*filename); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(filename string) error {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p := fxparser.NewParser(fxlex.NewLexer(bufio.NewReader(file), filename))
+	p.DebugDesc = false
+	//the standard output is for the expanded program
+	p.Diag = os.Stderr
+	prog, errs := p.Parse()
+	if errs != nil {
+		return fmt.Errorf("%s: %d errors", filename, len(errs))
+	}
+	if errs := fxopt.Inline(prog); errs != nil {
+		return errors.Join(errs...)
+	}
+	return fxparser.Fprint(os.Stdout, prog)
+}
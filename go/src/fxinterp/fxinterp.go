@@ -0,0 +1,320 @@
+package fxinterp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"fxcanvas"
+	"fxlex"
+	"fxparser"
+	"fxsym"
+)
+
+//The interpreter walks the tree of a program without errors, as
+//returned by fxparser.Parse. Execution starts at main. Every call to a
+//builtin is a call to the canvas.
+
+//MaxDepth is the maximum number of nested calls to user functions
+const MaxDepth = 1000
+
+//frame holds the variables of a function call, every declaration has
+//its own symbol so blocks do not need frames of their own
+type frame map[*fxsym.Sym]Value
+
+type Interp struct {
+	prog   *fxparser.Program
+	funcs  map[*fxsym.Sym]*fxparser.FuncDecl
+	canvas fxcanvas.Canvas
+	ctx    context.Context
+	depth  int
+}
+
+func New(prog *fxparser.Program, canvas fxcanvas.Canvas) *Interp {
+
+	in := &Interp{prog: prog, funcs: map[*fxsym.Sym]*fxparser.FuncDecl{}, canvas: canvas}
+	for _, fn := range prog.Funcs {
+		in.funcs[fn.Sym] = fn
+	}
+	return in
+}
+
+func errAt(tok fxlex.Token, message string) error {
+	return fmt.Errorf("%s: %s", tok.Start, message)
+}
+
+//Run executes main, which has no parameters. It stops with the error of
+//ctx when it is done, what was drawn until then stays in the canvas.
+func (in *Interp) Run(ctx context.Context) error {
+
+	in.ctx = ctx
+
+	main := in.prog.Func("main")
+	if main == nil {
+		return errors.New(in.prog.Tok.File + ": No function main")
+	}
+	if len(main.Params) != 0 {
+		return errAt(main.Tok, "Function main has parameters")
+	}
+	return in.call(main, nil, main.Tok)
+}
+
+//call runs fn, at is the call, where the errors of the call are
+func (in *Interp) call(fn *fxparser.FuncDecl, args []Value, at fxlex.Token) error {
+
+	if err := in.ctx.Err(); err != nil {
+		return err
+	}
+	if in.depth >= MaxDepth {
+		return errAt(at, "Too many nested calls to "+fn.Name)
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+	if g, ok := in.canvas.(fxcanvas.Grouper); ok {
+		g.Begin(fn.Name)
+		defer g.End(fn.Name)
+	}
+
+	fr := frame{}
+	for i, param := range fn.Params {
+		fr[param.Sym] = args[i]
+	}
+	return in.execBlock(fr, fn.Body)
+}
+
+func (in *Interp) execBlock(fr frame, block *fxparser.Block) error {
+
+	for _, stmt := range block.Stmts {
+		if err := in.exec(fr, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *Interp) exec(fr frame, stmt fxparser.Stmt) error {
+
+	switch stmt := stmt.(type) {
+	case *fxparser.VarDecl:
+		fr[stmt.Sym] = Zero(stmt.Sym.Type)
+	case *fxparser.AssignStmt:
+		v, err := in.eval(fr, stmt.Value)
+		if err != nil {
+			return err
+		}
+		return in.assign(fr, stmt.Target, Copy(v))
+	case *fxparser.CallStmt:
+		args := []Value{}
+		for _, arg := range stmt.Args {
+			v, err := in.eval(fr, arg)
+			if err != nil {
+				return err
+			}
+			args = append(args, Copy(v))
+		}
+		if stmt.Sym.Kind == fxsym.SBuiltin {
+			in.draw(stmt.Name, args)
+			return nil
+		}
+		return in.call(in.funcs[stmt.Sym], args, stmt.Tok)
+	case *fxparser.IterStmt:
+		return in.iter(fr, stmt)
+	case *fxparser.IfStmt:
+		cond, err := in.eval(fr, stmt.Cond)
+		if err != nil {
+			return err
+		}
+		if cond.(bool) {
+			return in.execBlock(fr, stmt.Then)
+		}
+		if stmt.Else != nil {
+			return in.exec(fr, stmt.Else)
+		}
+	case *fxparser.Block:
+		return in.execBlock(fr, stmt)
+	}
+	return nil
+}
+
+//iter runs the body from start to the bound, both included. The bound
+//and the step are evaluated once, before the loop. With a negative step
+//it counts down.
+func (in *Interp) iter(fr frame, stmt *fxparser.IterStmt) error {
+
+	var vals [3]int64
+	for i, e := range []fxparser.Expr{stmt.Start, stmt.End, stmt.Step} {
+		v, err := in.eval(fr, e)
+		if err != nil {
+			return err
+		}
+		vals[i] = v.(int64)
+	}
+	start, end, step := vals[0], vals[1], vals[2]
+	if step == 0 {
+		return errAt(stmt.Step.Token(), "Iter step is 0")
+	}
+
+	sym := stmt.Var.Sym
+	for i := start; (step > 0 && i <= end) || (step < 0 && i >= end); {
+		if err := in.ctx.Err(); err != nil {
+			return err
+		}
+		fr[sym] = i
+		if err := in.execBlock(fr, stmt.Body); err != nil {
+			return err
+		}
+		//the body may assign the variable
+		next := fr[sym].(int64) + step
+		if (step > 0) != (next > fr[sym].(int64)) {
+			break //overflow
+		}
+		i = next
+	}
+	delete(fr, sym)
+	return nil
+}
+
+//draw calls the canvas, the arguments were checked against the
+//signatures of fxsym.Builtins
+func (in *Interp) draw(name string, args []Value) {
+
+	p := args[0].(*Record)
+	point := fxcanvas.Point{X: p.Fields[0].(int64), Y: p.Fields[1].(int64)}
+	n := args[1].(int64)
+	color := fxcanvas.Color(args[2].(int64))
+	switch name {
+	case "circle":
+		in.canvas.Circle(point, n, color)
+	case "rect":
+		in.canvas.Rect(point, n, color)
+	}
+}
+
+//assign stores v in the variable or the field of the target
+func (in *Interp) assign(fr frame, target fxparser.Expr, v Value) error {
+
+	switch target := target.(type) {
+	case *fxparser.Ident:
+		fr[target.Sym] = v
+	case *fxparser.SelectorExpr:
+		x, err := in.eval(fr, target.X)
+		if err != nil {
+			return err
+		}
+		r := x.(*Record)
+		r.Fields[fieldIndex(r.Type, target.Sel.Name)] = v
+	default:
+		return errAt(target.Token(), "Cannot assign to expression")
+	}
+	return nil
+}
+
+//eval does not copy records, a selector or an assignment of its result
+//modifies the variable
+func (in *Interp) eval(fr frame, expr fxparser.Expr) (Value, error) {
+
+	switch expr := expr.(type) {
+	case *fxparser.IntLit:
+		return expr.Value, nil
+	case *fxparser.BoolLit:
+		return expr.Value, nil
+	case *fxparser.Ident:
+		return fr[expr.Sym], nil
+	case *fxparser.CoordLit:
+		x, err := in.eval(fr, expr.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := in.eval(fr, expr.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &Record{Type: fxsym.TypeCoord, Fields: []Value{x, y}}, nil
+	case *fxparser.SelectorExpr:
+		x, err := in.eval(fr, expr.X)
+		if err != nil {
+			return nil, err
+		}
+		return x.(*Record).Field(expr.Sel.Name), nil
+	case *fxparser.UnaryExpr:
+		x, err := in.eval(fr, expr.X)
+		if err != nil {
+			return nil, err
+		}
+		switch expr.Op {
+		case fxlex.TokType('!'):
+			return !x.(bool), nil
+		case fxlex.TokType('-'):
+			return -x.(int64), nil
+		}
+		return x, nil
+	case *fxparser.BinaryExpr:
+		x, err := in.eval(fr, expr.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := in.eval(fr, expr.Y)
+		if err != nil {
+			return nil, err
+		}
+		return binary(expr.Tok, x, y)
+	}
+	return nil, errAt(expr.Token(), "Bad expression")
+}
+
+func binary(op fxlex.Token, x, y Value) (Value, error) {
+
+	switch op.Type {
+	case fxlex.TokEqual:
+		return x == y, nil
+	case fxlex.TokType('|'):
+		return x.(bool) || y.(bool), nil
+	case fxlex.TokType('&'):
+		return x.(bool) && y.(bool), nil
+	case fxlex.TokType('^'):
+		return x.(bool) != y.(bool), nil
+	}
+
+	a, b := x.(int64), y.(int64)
+	switch op.Type {
+	case fxlex.TokType('+'):
+		return a + b, nil
+	case fxlex.TokType('-'):
+		return a - b, nil
+	case fxlex.TokType('*'):
+		return a * b, nil
+	case fxlex.TokType('/'), fxlex.TokType('%'):
+		if b == 0 {
+			return nil, errAt(op, "Division by zero")
+		}
+		if op.Type == fxlex.TokType('/') {
+			return a / b, nil
+		}
+		return a % b, nil
+	case fxlex.TokDMul:
+		if b < 0 {
+			return nil, errAt(op, "Negative exponent")
+		}
+		return Pow(a, b), nil
+	case fxlex.TokType('<'):
+		return a < b, nil
+	case fxlex.TokType('>'):
+		return a > b, nil
+	case fxlex.TokSmaller:
+		return a <= b, nil
+	case fxlex.TokGreater:
+		return a >= b, nil
+	}
+	return nil, errAt(op, "Bad operator "+op.Lexema)
+}
+
+//Pow returns a ** b for b >= 0, it wraps around like * on overflow
+func Pow(a, b int64) int64 {
+	r := int64(1)
+	for ; b > 0; b >>= 1 {
+		if b&1 == 1 {
+			r *= a
+		}
+		a *= a
+	}
+	return r
+}
@@ -0,0 +1,205 @@
+package fxinterp_test
+
+import (
+	"context"
+	"fmt"
+	"fxcanvas"
+	. "fxinterp"
+	"fxtest"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, text string) ([]string, error) {
+
+	rec := &fxcanvas.Recorder{}
+	err := New(fxtest.Parse(t, "interp_test.fx", text), rec).Run(context.Background())
+	return rec.Strings(), err
+}
+
+func checkCmds(t *testing.T, cmds []string, wanted []string) {
+	if strings.Join(cmds, "\n") != strings.Join(wanted, "\n") {
+		t.Errorf("drew\n\t%s\nshould be\n\t%s", strings.Join(cmds, "\n\t"), strings.Join(wanted, "\n\t"))
+	}
+}
+
+func TestLang(t *testing.T) {
+
+	cmds, err := run(t, fxtest.Lang(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCmds(t, cmds, []string{
+		"circle([4, 45], 2, 0x1100001f)",
+		"circle([0, 0], 2, 0x00000001)",
+		"circle([6, 16], 2, 0x00000001)",
+		"circle([0, 0], 2, 0x00000001)",
+		"circle([6, 16], 2, 0x00000001)",
+		"rect([4, 45], 5, 0x000000ff)",
+		"rect([4, 45], 5, 0x000000ff)",
+		"rect([4, 45], 5, 0x000000ff)",
+		"rect([4, 45], 5, 0x000000ff)",
+	})
+}
+
+func TestByValue(t *testing.T) {
+
+	const text = "type record seg(Coord a, Coord b)\n" +
+		"func move(seg s, int n){\n" +
+		"  s.a.x = 100;\n" +
+		"  n = 0;\n" +
+		"  circle(s.a, n, 0);\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  seg s;\n" +
+		"  seg t;\n" +
+		"  int n;\n" +
+		"  n = 5;\n" +
+		"  s.a = [1, 2];\n" +
+		"  t = s;\n" +
+		"  t.a.y = 7;\n" +
+		"  move(s, n);\n" +
+		"  circle(s.a, n, 0);\n" +
+		"  rect(t.a, n, 0);\n" +
+		"  rect(t.b, -n ** 2 % 7, 0);\n" +
+		"}\n"
+
+	cmds, err := run(t, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCmds(t, cmds, []string{
+		"circle([100, 2], 0, 0x00000000)",
+		"circle([1, 2], 5, 0x00000000)",
+		"rect([1, 7], 5, 0x00000000)",
+		"rect([0, 0], -4, 0x00000000)",
+	})
+}
+
+func TestIter(t *testing.T) {
+
+	const text = "func main(){\n" +
+		"  iter (i := 5; 1, -2){\n" +
+		"    circle([i, 0], 1, 0);\n" +
+		"  }\n" +
+		"  iter (i := 0; 10, 3){\n" +
+		"    int k;\n" +
+		"    if (i == 3) {\n" +
+		"      i = 8;\n" +
+		"    } else if (i > 8) {\n" +
+		"      k = 1;\n" +
+		"    }\n" +
+		"    circle([i, k], 1, 0);\n" +
+		"  }\n" +
+		"  iter (i := 1; 0, 1){\n" +
+		"    circle([i, i], 1, 0);\n" +
+		"  }\n" +
+		"}\n"
+
+	cmds, err := run(t, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCmds(t, cmds, []string{
+		"circle([5, 0], 1, 0x00000000)",
+		"circle([3, 0], 1, 0x00000000)",
+		"circle([1, 0], 1, 0x00000000)",
+		"circle([0, 0], 1, 0x00000000)",
+		"circle([8, 0], 1, 0x00000000)",
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+
+	tests := []struct {
+		text string
+		err  string
+		n    int
+	}{
+		{"func main(){\n  int z;\n  circle([1, 1], 1, 0);\n  circle([1, 1], 1 / z, 0);\n}\n",
+			"interp_test.fx:4:20: Division by zero", 1},
+		{"func main(){\n  iter (i := 0; 3, 1 - 1){\n    circle([i, i], 1, 0);\n  }\n}\n",
+			"interp_test.fx:2:22: Iter step is 0", 0},
+		{"func main(){\n  circle([1, 1], 2 ** -1, 0);\n}\n",
+			"interp_test.fx:2:20: Negative exponent", 0},
+		{fxtest.Chain(MaxDepth, 1), fmt.Sprintf("interp_test.fx:5:3: Too many nested calls to f%d", MaxDepth), 0},
+		{"func f(){\n  circle([1, 1], 1, 0);\n}\n",
+			"interp_test.fx: No function main", 0},
+		{"func main(int x){\n  circle([x, x], 1, 0);\n}\n",
+			"interp_test.fx:1:6: Function main has parameters", 0},
+	}
+	for _, test := range tests {
+		cmds, err := run(t, test.text)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("error is %v, should be %s", err, test.err)
+		}
+		if len(cmds) != test.n {
+			t.Errorf("%s: drew %d commands, should be %d", test.err, len(cmds), test.n)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+
+	const text = "func main(){\n" +
+		"  iter (i := 1; 2, 1){\n" +
+		"    circle([i, 2 * i], 10, 2130706687);\n" +
+		"  }\n" +
+		"  rect([3, 4], 45, 0);\n" +
+		"}\n"
+
+	rec := &fxcanvas.Recorder{}
+	if err := Run(context.Background(), strings.NewReader(text), "run_test.fx", rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Cmds) != 3 {
+		t.Fatalf("drew %v", rec.Strings())
+	}
+	want := fxcanvas.Cmd{Name: "circle", P: fxcanvas.Point{X: 2, Y: 4}, N: 10, Color: 0x7f0000ff}
+	if rec.Cmds[1] != want || rec.Cmds[2].Name != "rect" || rec.Cmds[2].N != 45 {
+		t.Errorf("drew %v", rec.Strings())
+	}
+
+	rec = &fxcanvas.Recorder{}
+	err := Run(context.Background(), strings.NewReader("func main(){\n  circle(1, 2, 3);\n}\n"), "run_test.fx", rec)
+	if err == nil || err.Error() != "run_test.fx:2:10: Argument p of type int in call to circle, must be Coord" {
+		t.Errorf("bad error %v", err)
+	}
+	if len(rec.Cmds) != 0 {
+		t.Errorf("drew %v with errors", rec.Strings())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Run(ctx, strings.NewReader(text), "run_test.fx", rec)
+	if err != context.Canceled || len(rec.Cmds) != 0 {
+		t.Errorf("canceled run returned %v and drew %v", err, rec.Strings())
+	}
+}
+
+//Run is for embedding, the errors are returned and nothing is printed
+func TestRunQuiet(t *testing.T) {
+
+	out, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+	}()
+
+	const text = "func main(){\n  int a;\n  a = 2;\n  a = ;\n  circle(a, 2, 3);\n}\n"
+	err = Run(context.Background(), strings.NewReader(text), "run_test.fx", &fxcanvas.Recorder{})
+	os.Stdout, os.Stderr = stdout, stderr
+	if err == nil {
+		t.Error("no errors")
+	}
+	out.Seek(0, io.SeekStart)
+	if printed, _ := io.ReadAll(out); len(printed) != 0 {
+		t.Errorf("Run printed %q", printed)
+	}
+}
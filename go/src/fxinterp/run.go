@@ -0,0 +1,26 @@
+package fxinterp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fxcanvas"
+	"fxlex"
+	"fxparser"
+	"io"
+)
+
+//Run parses and checks the fx program read from source and executes its
+//main drawing on canvas. filename is used in the error messages. If the
+//program has errors nothing is drawn and all of them are returned.
+func Run(ctx context.Context, source io.Reader, filename string, canvas fxcanvas.Canvas) error {
+
+	l := fxlex.NewLexer(bufio.NewReader(source), filename)
+	p := fxparser.NewParser(l)
+	p.DebugDesc = false
+	prog, errs := p.Parse()
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+	return New(prog, canvas).Run(ctx)
+}
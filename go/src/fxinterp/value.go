@@ -0,0 +1,78 @@
+package fxinterp
+
+import (
+	"fmt"
+	"fxsym"
+	"strings"
+)
+
+//Value is the value of an fx expression: an int64, a bool or a *Record.
+//Coord values are records of type fxsym.TypeCoord.
+type Value interface{}
+
+//Record is the value of a Coord or a record type, the fields are in
+//the order they are declared
+type Record struct {
+	Type   *fxsym.Type
+	Fields []Value
+}
+
+func (r *Record) String() string {
+	vals := []string{}
+	for _, f := range r.Fields {
+		vals = append(vals, fmt.Sprint(f))
+	}
+	if r.Type == fxsym.TypeCoord {
+		return "[" + strings.Join(vals, ", ") + "]"
+	}
+	return r.Type.Name + "{" + strings.Join(vals, ", ") + "}"
+}
+
+//Field returns the value of the field with name, or nil
+func (r *Record) Field(name string) Value {
+	if i := fieldIndex(r.Type, name); i >= 0 {
+		return r.Fields[i]
+	}
+	return nil
+}
+
+func fieldIndex(t *fxsym.Type, name string) int {
+	for i, f := range t.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//Zero returns the value of a variable of type t before it is assigned:
+//0, False or a record with all its fields zero
+func Zero(t *fxsym.Type) Value {
+
+	switch t.Kind {
+	case fxsym.TInt:
+		return int64(0)
+	case fxsym.TBool:
+		return false
+	}
+	r := &Record{Type: t}
+	for _, f := range t.Fields {
+		r.Fields = append(r.Fields, Zero(f.Type))
+	}
+	return r
+}
+
+//Copy returns v, a deep copy if it is a record. fx passes and assigns
+//everything by value.
+func Copy(v Value) Value {
+
+	r, ok := v.(*Record)
+	if !ok {
+		return v
+	}
+	c := &Record{Type: r.Type, Fields: make([]Value, len(r.Fields))}
+	for i, f := range r.Fields {
+		c.Fields[i] = Copy(f)
+	}
+	return c
+}
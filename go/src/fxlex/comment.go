@@ -0,0 +1,92 @@
+package fxlex
+
+import "strings"
+
+//Comment is a // or a /* */ comment, Text has the comment markers
+type Comment struct {
+	Text  string
+	Start Position
+	End   Position
+}
+
+//CommentGroup is a run of comments with no tokens or blank lines
+//between them
+type CommentGroup struct {
+	List []Comment
+}
+
+//Text returns the text of the comments without the markers and the
+//spaces around each line
+func (g *CommentGroup) Text() string {
+
+	if g == nil {
+		return ""
+	}
+	lines := []string{}
+	for _, c := range g.List {
+		text := strings.TrimPrefix(c.Text, "//")
+		if strings.HasPrefix(c.Text, "/*") {
+			text = strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+//lexBlockComment lexes a /* */ comment, the / is already got. It
+//returns false if the file ends before the comment.
+func (l *Lexer) lexBlockComment() bool {
+
+	l.get()
+	for depth := 1; depth > 0; {
+		switch r := l.get(); {
+		case r == RuneEOF:
+			return false
+		case r == '*' && l.peekRune(0) == '/':
+			l.get()
+			depth--
+		case r == '/' && l.peekRune(0) == '*' && l.NestedComments:
+			l.get()
+			depth++
+		}
+	}
+	l.addComment(l.accept())
+	return true
+}
+
+//addComment adds the comment just accepted to the doc of the next
+//token. A comment after a token in the same line is not a doc, and a
+//blank line starts a new group.
+func (l *Lexer) addComment(text string) {
+
+	c := Comment{Text: text, Start: l.tokStart, End: l.position()}
+	switch {
+	case c.Start.Line == l.lastLine:
+		l.doc = nil
+		return
+	case l.doc != nil && c.Start.Line > l.doc.List[len(l.doc.List)-1].End.Line+1:
+		l.doc = nil
+	}
+	if l.doc == nil {
+		l.doc = &CommentGroup{}
+	}
+	l.doc.List = append(l.doc.List, c)
+}
+
+//attachDoc gives the comments right above the token to it
+func (l *Lexer) attachDoc(t *Token) {
+
+	if l.doc != nil && l.doc.List[len(l.doc.List)-1].End.Line >= t.Start.Line-1 {
+		t.Doc = l.doc
+	}
+	l.doc = nil
+	l.lastLine = t.End.Line
+}
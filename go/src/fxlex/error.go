@@ -0,0 +1,44 @@
+package fxlex
+
+import "fmt"
+
+//kinds of lexer errors
+
+type ErrorKind int
+
+const (
+	ErrNone ErrorKind = iota
+	ErrBadChar
+	ErrUnterminatedComment
+	ErrInvalidLiteral
+	ErrRead
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrNone:                "no error",
+	ErrBadChar:             "bad char",
+	ErrUnterminatedComment: "unterminated comment",
+	ErrInvalidLiteral:      "invalid literal",
+	ErrRead:                "read error",
+}
+
+func (k ErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+//Error is an error found by the lexer at Pos. Err is the error of the
+//reader for ErrRead.
+type Error struct {
+	Pos  Position
+	Kind ErrorKind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -49,7 +49,7 @@ var reserved_words_map = map[string]Token{
 	"func":   Token{Lexema: "func", Type: TokFunc},
 	"main":   Token{Lexema: "main", Type: TokMain},
 	"type":   Token{Lexema: "type", Type: TokTypeDef},
-	"if":     Token{Lexema: "Rect", Type: TokIf},
+	"if":     Token{Lexema: "if", Type: TokIf},
 	"else":   Token{Lexema: "else", Type: TokElse},
 	"iter":   Token{Lexema: "iter", Type: TokIter},
 	"record": Token{Lexema: "record", Type: TokRecord},
@@ -67,8 +67,17 @@ type Token struct {
 	TokValString string
 	Line         int
     File         string
+	//where the token starts and where it ends, End is just past its
+	//last byte. Pos is Start in the FileSet of the lexer
+	Start Position
+	End   Position
+	Pos   Pos
+	//the comments right above the token, nil if there are none
+	Doc *CommentGroup
 }
 
+//RuneScanner is the source of a Lexer. The lexer keeps its own
+//lookahead, so it only uses ReadRune.
 type RuneScanner interface {
 	ReadRune() (r rune, size int, err error)
 	UnreadRune() error
@@ -77,11 +86,44 @@ type RuneScanner interface {
 type Lexer struct {
 	file     string
 	line     int
+	col      int
+	offset   int
+	fset     *FileSet
+	src      *File
+	tokStart Position
 	rs       RuneScanner
 	lastrune rune
 	accepted []rune
-	tokSaved *Token
+	//the runes read from rs and not got yet, and the runes got since
+	//the last accept, to unget them
+	ahead []srcRune
+	got   []gotRune
+	//the token stream, see stream.go
+	toks  tokRing
+	base  int
+	next  int
+	marks []int
+	//the comments that may be the doc of the next token and the line
+	//where the last token ends
+	doc      *CommentGroup
+	lastLine int
 	dflag    bool
+	//NestedComments makes /* */ comments nest, so /* /* */ */ is one
+	NestedComments bool
+}
+
+//srcRune is a rune read from the source, a read error is kept in err
+//until the rune is got, then it is RuneEOF
+type srcRune struct {
+	r    rune
+	size int
+	err  error
+}
+
+//gotRune is a rune got and the position before it
+type gotRune struct {
+	src srcRune
+	pos Position
 }
 
 func parseArguments() (string, bool) {
@@ -97,9 +139,19 @@ func parseArguments() (string, bool) {
 	return *filenamePtr, *dflagPtr
 }
 
+//NewLexer returns a lexer for the file, registered in a FileSet of its
+//own
 func NewLexer(rs RuneScanner, filename string, debug ...bool) (l *Lexer) {
-	l = &Lexer{line: 1}
+	return NewFileLexer(NewFileSet(), rs, filename, debug...)
+}
+
+//NewFileLexer returns a lexer for the file, registered in fset so the
+//Pos of its tokens can be found there
+func NewFileLexer(fset *FileSet, rs RuneScanner, filename string, debug ...bool) (l *Lexer) {
+	l = &Lexer{line: 1, col: 1}
 	l.file = filename
+	l.fset = fset
+	l.src = fset.AddFile(filename)
 	l.rs = rs
 	if v := len(debug); v > 0 {
 		if debug[0] {
@@ -109,52 +161,119 @@ func NewLexer(rs RuneScanner, filename string, debug ...bool) (l *Lexer) {
 	return l
 }
 
-func (l *Lexer) get() (r rune) {
+//fill reads from the source until there are k+1 runes ahead, or up to
+//the end of the source
+func (l *Lexer) fill(k int) {
 
-	var err error
+	for len(l.ahead) <= k {
+		if n := len(l.ahead); n > 0 && l.ahead[n-1].r == RuneEOF {
+			return
+		}
+		r, size, err := l.rs.ReadRune()
+		if err != nil {
+			r = RuneEOF
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		l.ahead = append(l.ahead, srcRune{r: r, size: size, err: err})
+	}
+}
 
-	rune, _, err := l.rs.ReadRune()
+//peekRune returns the rune k positions after the next one without
+//getting it, RuneEOF past the end
+func (l *Lexer) peekRune(k int) rune {
 
-	if err == nil {
-		l.lastrune = rune
-		if rune == '\n' {
-			l.line++
-		}
-	} else if err == io.EOF {
+	l.fill(k)
+	if k >= len(l.ahead) {
+		return RuneEOF
+	}
+	return l.ahead[k].r
+}
+
+func (l *Lexer) get() (r rune) {
+
+	if len(l.accepted) == 0 {
+		l.tokStart = l.position()
+	}
+	l.fill(0)
+	next := l.ahead[0]
+	if next.r == RuneEOF {
 		l.lastrune = RuneEOF
+		if next.err != nil {
+			//reported once, the rest of the file is lost
+			l.ahead[0].err = nil
+			panic(&Error{Pos: l.position(), Kind: ErrRead, Msg: "Read error: " + next.err.Error(), Err: next.err})
+		}
 		return RuneEOF
 	}
 
-	if err != nil {
-		panic(err)
+	l.ahead = l.ahead[1:]
+	l.got = append(l.got, gotRune{src: next, pos: l.position()})
+	l.lastrune = next.r
+	l.offset += next.size
+	l.col += next.size
+	if next.r == '\n' {
+		l.line++
+		l.col = 1
+		l.src.AddLine(l.offset)
 	}
-	l.accepted = append(l.accepted, rune)
+	l.accepted = append(l.accepted, next.r)
 
-	return rune
+	return next.r
 }
 
+//unget gives back the last rune got, it can be called again to give
+//back the ones before up to the last accept. Getting RuneEOF is undone
+//by its own unget.
 func (l *Lexer) unget() {
 
-	var err error
-
 	if l.lastrune == RuneEOF {
+		l.lastrune = unicode.ReplacementChar
 		return
 	}
-
-	err = l.rs.UnreadRune()
-
-	if err == nil && l.lastrune == '\n' {
-		l.line--
+	n := len(l.got)
+	if n == 0 {
+		panic(errors.New("unget with no rune got"))
 	}
+	last := l.got[n-1]
+	l.got = l.got[:n-1]
+	l.ahead = append([]srcRune{last.src}, l.ahead...)
+	l.line, l.col, l.offset = last.pos.Line, last.pos.Col, last.pos.Offset
+	l.accepted = l.accepted[:len(l.accepted)-1]
 	l.lastrune = unicode.ReplacementChar
-	if len(l.accepted) != 0 {
-		l.accepted = l.accepted[0 : len(l.accepted)-1]
-	}
+}
 
-	if err != nil {
-		panic(err)
-	}
+func (l *Lexer) position() Position {
+	return Position{File: l.file, Line: l.line, Col: l.col, Offset: l.offset}
+}
 
+//FileSet returns the FileSet where the file of the lexer is
+func (l *Lexer) FileSet() *FileSet {
+	return l.fset
+}
+
+//File returns the file of the lexer in its FileSet
+func (l *Lexer) File() *File {
+	return l.src
+}
+
+//setPos sets the position of the token just accepted
+func (l *Lexer) setPos(t *Token) {
+	t.Start, t.End = l.tokStart, l.position()
+	t.Pos = l.src.Pos(t.Start.Offset)
+	t.Line = t.Start.Line
+	t.File = l.file
+}
+
+//bad returns what was read of the token as a TokBad token, with the
+//error of the given kind
+func (l *Lexer) bad(kind ErrorKind, msg string) (t Token, err error) {
+	t.Lexema = string(l.accepted)
+	l.accepted, l.got = nil, nil
+	t.Type = TokBad
+	l.setPos(&t)
+	return t, &Error{Pos: t.Start, Kind: kind, Msg: msg}
 }
 
 func (l *Lexer) accept() (tok string) {
@@ -163,7 +282,7 @@ func (l *Lexer) accept() (tok string) {
 	if tok == "" && l.lastrune != RuneEOF {
 		panic(errors.New("empty token"))
 	}
-	l.accepted = nil
+	l.accepted, l.got = nil, nil
 	return tok
 
 }
@@ -174,7 +293,10 @@ func (l *Lexer) lexComment() {
 		switch r {
 		case '\n':
 			l.unget()
-			l.accept()
+			l.addComment(l.accept())
+			return
+		case RuneEOF:
+			l.addComment(l.accept())
 			return
 		}
 	}
@@ -186,15 +308,6 @@ func (l *Lexer) lexOp() (t Token, err error) {
 		ops = "+-*/><=%|&!^=:"
 	)
 
-	//special case. RuneScanner doesn't allow to use unget() twice in a row (line 403), so
-	//the lookahead rune and the rune before that cannot be ungetted (comment case).
-
-	if string(l.accepted) == "/" {
-		t.Lexema = l.accept()
-		t.Type = TokType('/')
-		return t, nil
-	}
-
 	r := l.get()
 
 	switch r {
@@ -258,7 +371,7 @@ func (l *Lexer) lexOp() (t Token, err error) {
 			t.Lexema = l.accept()
 			t.Type = TokType(r)
 		} else {
-			panic(errors.New("Bad operator"))
+			return l.bad(ErrBadChar, fmt.Sprintf("Bad operator %q", r))
 		}
 
 	}
@@ -305,60 +418,82 @@ func (l *Lexer) lexSep() (t Token, err error) {
 		return t, nil
 
 	} else {
-		panic(errors.New("Bad separator"))
+		return l.bad(ErrBadChar, fmt.Sprintf("Bad separator %q", r))
 	}
 
 }
 
-func (l *Lexer) lexNum() (t Token, err error) {
-
-	const validHex = "ABCDEFabcdef"
+//base and name of the number literals by the letter after their 0
+var numBases = map[rune]struct {
+	base int
+	name string
+}{
+	'x': {16, "hexadecimal"},
+	'b': {2, "binary"},
+	'o': {8, "octal"},
+}
 
-	var isHex = false
+//lexNum lexes decimal literals, and hexadecimal, binary and octal ones
+//with a 0x, 0b or 0o prefix. A _ may separate two digits or the prefix
+//and a digit. Letters and digits right after the literal are part of
+//it, so 12ab is a bad literal and not 12 and ab. Decimal literals do
+//not start with 0, but for 0 itself.
+func (l *Lexer) lexNum() (t Token, err error) {
 
-	for r := l.get(); ; r = l.get() {
+	base, name, prefix := 10, "decimal", 0
+	if r := l.get(); r == '0' {
+		if b, ok := numBases[unicode.ToLower(l.peekRune(0))]; ok {
+			l.get()
+			base, name, prefix = b.base, b.name, 2
+		}
+	}
+	for r := l.get(); unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'; r = l.get() {
+	}
+	l.unget()
 
-		switch {
+	t.Lexema = l.accept()
+	t.Type = TokValInt
+	t.TokValInt, err = l.numValue(t.Lexema, prefix, base, name)
+	return t, err
+}
 
-		case r == '0':
-			if !isHex {
-				//fmt.Println("Number is zero. Might be hexadecimal")
-				look_token := l.get()
-				if look_token == 'x' {
-					//fmt.Println("Hexadecimal")
-					isHex = true
-				} else {
-					l.unget()
-				}
-			}
+func (l *Lexer) literalErr(format string, args ...interface{}) error {
+	return &Error{Pos: l.tokStart, Kind: ErrInvalidLiteral, Msg: fmt.Sprintf(format, args...)}
+}
 
-		case unicode.IsNumber(r):
-			//fmt.Println("rune is an integer")
+//numValue checks the digits of a number literal and returns its value
+func (l *Lexer) numValue(lexema string, prefix int, base int, name string) (int64, error) {
 
-		case strings.ContainsRune(validHex, r):
-			//fmt.Println("rune is a hexadecimal letrter")
+	const hexDigits = "0123456789abcdef"
 
-		default:
-			l.unget()
-			t.Lexema = l.accept()
-			t.Type = TokValInt
-			t.TokValInt, err = strconv.ParseInt(t.Lexema, 10, 64)
-			return t, nil
+	digits := lexema[prefix:]
+	if strings.Trim(digits, "_") == "" {
+		return 0, l.literalErr("Missing digits in %s literal %s", name, lexema)
+	}
+	for _, r := range digits {
+		if d := strings.IndexRune(hexDigits, unicode.ToLower(r)); r != '_' && (d < 0 || d >= base) {
+			return 0, l.literalErr("Invalid digit %q in %s literal %s", r, name, lexema)
 		}
 	}
-}
-
-func (l *Lexer) Peek() (t Token, err error) {
-
-	t, err = l.Lex()
-	if err == nil {
-		l.tokSaved = &t
+	if strings.Contains(digits, "__") || strings.HasSuffix(digits, "_") {
+		return 0, l.literalErr("_ must separate successive digits in literal %s", lexema)
 	}
-	return t, nil
-
+	//0777 would be 511 in C, octal literals are 0o777
+	if base == 10 && len(digits) > 1 && digits[0] == '0' {
+		return 0, l.literalErr("Leading 0 in decimal literal %s, octal literals start with 0o", lexema)
+	}
+	v, err := strconv.ParseInt(strings.ReplaceAll(digits, "_", ""), base, 64)
+	if err != nil {
+		return 0, l.literalErr("Literal %s out of the int range", lexema)
+	}
+	return v, nil
 }
 
-func (l *Lexer) Lex() (t Token, err error) {
+//scan lexes the next token from the source. On errors it is a *Error
+//and the token is the TokBad with the text that could not be lexed, but
+//for bad number literals, which are TokValInt of value 0. After a read
+//error the lexer returns TokEof.
+func (l *Lexer) scan() (t Token, err error) {
 
 	const (
 		BugMsg = "compiler error:"
@@ -368,23 +503,23 @@ func (l *Lexer) Lex() (t Token, err error) {
 	defer func() {
 
 		if e := recover(); e != nil {
+			if lerr, ok := e.(*Error); ok {
+				t, _ = l.bad(lerr.Kind, lerr.Msg)
+				err = lerr
+				return
+			}
 			errs := fmt.Sprint(e)
 			if strings.HasPrefix(errs, "runtime error:") {
 				errs = strings.Replace(errs, RunMsg, BugMsg, 1)
 			}
-			err := errors.New(errs)
+			t, _ = l.bad(ErrNone, errs)
+			err = errors.New(errs)
 			if l.dflag {
 				fmt.Fprintf(os.Stderr, "%s\n%s", err, debug.Stack())
 			}
 		}
 	}()
 
-	if l.tokSaved != nil {
-		t = *l.tokSaved
-		l.tokSaved = nil
-		return t, nil
-	}
-
 	for r := l.get(); ; r = l.get() {
 		if unicode.IsSpace(r) {
 			l.accept()
@@ -394,31 +529,26 @@ func (l *Lexer) Lex() (t Token, err error) {
 
 		case '+', '-', '*', '/', '>', '<', '=', ':', '%', '|', '&', '!', '^': //operator or comment
 
-			if r == '/' {
-				look_token := l.get()
-				if look_token == '/' { //it's a comment
-					l.lexComment()
-				} else { //not a comment so unget and continue
-					l.unget()
-					t, err = l.lexOp()
-					t.Line = l.line
-                    t.File = l.file
-					return t, err
+			if r == '/' && l.peekRune(0) == '/' { //it's a comment
+				l.lexComment()
+				continue
+			}
+			if r == '/' && l.peekRune(0) == '*' {
+				if !l.lexBlockComment() {
+					return l.bad(ErrUnterminatedComment, "Unterminated comment")
 				}
-			} else {
-				l.unget()
-				t, err = l.lexOp()
-				t.Line = l.line
-                t.File = l.file
-				return t, err
+				continue
 			}
+			l.unget()
+			t, err = l.lexOp()
+			l.setPos(&t)
+			return t, err
 
 		case RuneEOF:
 
 			t.Lexema = l.accept()
 			t.Type = TokEof
-			t.Line = l.line
-            t.File = l.file
+			l.setPos(&t)
 
 			return t, nil
 
@@ -430,8 +560,7 @@ func (l *Lexer) Lex() (t Token, err error) {
 
 			l.unget()
 			t, err = l.lexSep()
-			t.Line = l.line
-            t.File = l.file
+			l.setPos(&t)
 			return t, err
 
 		default:
@@ -443,16 +572,17 @@ func (l *Lexer) Lex() (t Token, err error) {
 		case unicode.IsLetter(r):
 			l.unget()
 			t, err = l.lexId()
-			t.Line = l.line
-            t.File = l.file
+			l.setPos(&t)
 			return t, err
 
 		case unicode.IsNumber(r):
 			l.unget()
 			t, err = l.lexNum()
-			t.Line = l.line
-            t.File = l.file
+			l.setPos(&t)
 			return t, err
+
+		default:
+			return l.bad(ErrBadChar, fmt.Sprintf("Bad character %q", r))
 		}
 	}
 }
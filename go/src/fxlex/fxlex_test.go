@@ -2,11 +2,14 @@ package fxlex_test
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	. "fxlex"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 var filename = flag.String("file", "", "file to read")
@@ -134,3 +137,343 @@ func TestLexId(t *testing.T) {
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+
+	const text = "0 48 1_000_000 0xff 0X2dfadfd 0x_1F 0b101 0B1_0 0o17 0O7_7\n" +
+		"9223372036854775807 0x7fffffffffffffff"
+	values := []int64{0, 48, 1000000, 0xff, 0x2dfadfd, 0x1f, 5, 2, 15, 63,
+		9223372036854775807, 0x7fffffffffffffff}
+
+	myLexer := NewLexer(bufio.NewReader(strings.NewReader(text)), "testfile")
+	for i, v := range values {
+		token, err := myLexer.Lex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Type != TokValInt || token.TokValInt != v {
+			t.Errorf("literal %d: %s is %d, should be %d", i, token.Lexema, token.TokValInt, v)
+		}
+	}
+	if token, _ := myLexer.Lex(); token.Type != TokEof {
+		t.Errorf("expected EOF, got %s", token.Lexema)
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+
+	const text = "12ab;\n\t 0x;\n0b102;\n0o8;\n1__0;\n10_;\n0x_;\n9223372036854775808;\n0xfffffffffffffffff;\n1٣;\n0777;\n0_1;\n7"
+	wanted := []string{
+		"testfile:1:1: Invalid digit 'a' in decimal literal 12ab",
+		"testfile:2:3: Missing digits in hexadecimal literal 0x",
+		"testfile:3:1: Invalid digit '2' in binary literal 0b102",
+		"testfile:4:1: Invalid digit '8' in octal literal 0o8",
+		"testfile:5:1: _ must separate successive digits in literal 1__0",
+		"testfile:6:1: _ must separate successive digits in literal 10_",
+		"testfile:7:1: Missing digits in hexadecimal literal 0x_",
+		"testfile:8:1: Literal 9223372036854775808 out of the int range",
+		"testfile:9:1: Literal 0xfffffffffffffffff out of the int range",
+		"testfile:10:1: Invalid digit '٣' in decimal literal 1٣",
+		"testfile:11:1: Leading 0 in decimal literal 0777, octal literals start with 0o",
+		"testfile:12:1: Leading 0 in decimal literal 0_1, octal literals start with 0o",
+	}
+
+	myLexer := NewLexer(bufio.NewReader(strings.NewReader(text)), "testfile")
+	for i, w := range wanted {
+		token, err := myLexer.Lex()
+		if lerr, ok := err.(*Error); !ok || lerr.Kind != ErrInvalidLiteral {
+			t.Errorf("literal %d: error %v is not an invalid literal", i, err)
+		}
+		if err == nil || err.Error() != w {
+			t.Errorf("literal %d: error is %v, should be %q", i, err, w)
+		}
+		if token.Type != TokValInt {
+			t.Errorf("literal %d: %s is not a number", i, token.Lexema)
+		}
+		if token, _ := myLexer.Lex(); token.Type != TokType(';') {
+			t.Errorf("literal %d: followed by %s instead of ;", i, token.Lexema)
+		}
+	}
+	if token, err := myLexer.Lex(); err != nil || token.TokValInt != 7 {
+		t.Errorf("last literal is %s, %v", token.Lexema, err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+
+	const text = "func main(){\n\tcircle([1, 0x2], 3, 4);\n}\n"
+	type pos struct {
+		lexema     string
+		start, end Position
+	}
+	wanted := []pos{
+		{"func", Position{"testfile", 1, 1, 0}, Position{"testfile", 1, 5, 4}},
+		{"main", Position{"testfile", 1, 6, 5}, Position{"testfile", 1, 10, 9}},
+		{"(", Position{"testfile", 1, 10, 9}, Position{"testfile", 1, 11, 10}},
+		{")", Position{"testfile", 1, 11, 10}, Position{"testfile", 1, 12, 11}},
+		{"{", Position{"testfile", 1, 12, 11}, Position{"testfile", 1, 13, 12}},
+		{"circle", Position{"testfile", 2, 2, 14}, Position{"testfile", 2, 8, 20}},
+		{"(", Position{"testfile", 2, 8, 20}, Position{"testfile", 2, 9, 21}},
+		{"[", Position{"testfile", 2, 9, 21}, Position{"testfile", 2, 10, 22}},
+		{"1", Position{"testfile", 2, 10, 22}, Position{"testfile", 2, 11, 23}},
+		{",", Position{"testfile", 2, 11, 23}, Position{"testfile", 2, 12, 24}},
+		{"0x2", Position{"testfile", 2, 13, 25}, Position{"testfile", 2, 16, 28}},
+	}
+
+	fset := NewFileSet()
+	fset.AddFile("other")
+	myLexer := NewFileLexer(fset, bufio.NewReader(strings.NewReader(text)), "testfile")
+	for _, w := range wanted {
+		token, err := myLexer.Lex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Lexema != w.lexema || token.Start != w.start || token.End != w.end || token.Line != w.start.Line {
+			t.Errorf("token %s at %+v-%+v, should be %s at %+v-%+v", token.Lexema, token.Start, token.End, w.lexema, w.start, w.end)
+		}
+		if p := fset.Position(token.Pos); p != w.start {
+			t.Errorf("Pos of %s is %s, should be %s", token.Lexema, p, w.start)
+		}
+	}
+	for token, _ := myLexer.Lex(); token.Type != TokEof; token, _ = myLexer.Lex() {
+	}
+	if n := myLexer.File().LineCount(); n != 4 {
+		t.Errorf("file has %d lines, should be 4", n)
+	}
+	if p := fset.Position(myLexer.File().Pos(38)); p.String() != "testfile:3:1" {
+		t.Errorf("offset 38 is at %s", p)
+	}
+	if p := fset.Position(NoPos); p.IsValid() || p.String() != "-" {
+		t.Errorf("NoPos is at %s", p)
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+
+	myLexer := NewLexer(bufio.NewReader(strings.NewReader("a @ b\n  #x //comment")), "testfile")
+	type lexed struct {
+		lexema string
+		typ    TokType
+		err    string
+		kind   ErrorKind
+	}
+	wanted := []lexed{
+		{"a", TokId, "", ErrNone},
+		{"@", TokBad, "testfile:1:3: Bad character '@'", ErrBadChar},
+		{"b", TokId, "", ErrNone},
+		{"#", TokBad, "testfile:2:3: Bad character '#'", ErrBadChar},
+		{"x", TokId, "", ErrNone},
+		{"", TokEof, "", ErrNone},
+	}
+	for i, w := range wanted {
+		ptoken, perr := myLexer.Peek()
+		token, err := myLexer.Lex()
+		if ptoken != token || perr != err {
+			t.Errorf("token %d: Peek gives %s, %v and Lex %s, %v", i, ptoken.Lexema, perr, token.Lexema, err)
+		}
+		if token.Lexema != w.lexema || token.Type != w.typ {
+			t.Errorf("token %d is %q of type %d, should be %q of type %d", i, token.Lexema, token.Type, w.lexema, w.typ)
+		}
+		var lerr *Error
+		switch {
+		case w.err == "" && err != nil:
+			t.Errorf("token %d: unexpected error %v", i, err)
+		case w.err != "" && (!errors.As(err, &lerr) || lerr.Error() != w.err || lerr.Kind != w.kind):
+			t.Errorf("token %d: error is %v, should be %q (%s)", i, err, w.err, w.kind)
+		}
+	}
+}
+
+func TestReadError(t *testing.T) {
+
+	disk := errors.New("disk on fire")
+	reader := bufio.NewReader(io.MultiReader(strings.NewReader("a bc"), iotest.ErrReader(disk)))
+	myLexer := NewLexer(reader, "testfile")
+	if token, err := myLexer.Lex(); token.Lexema != "a" || err != nil {
+		t.Fatalf("first token is %q, %v", token.Lexema, err)
+	}
+	token, err := myLexer.Lex()
+	var lerr *Error
+	if !errors.As(err, &lerr) || lerr.Kind != ErrRead || !errors.Is(err, disk) ||
+		err.Error() != "testfile:1:5: Read error: disk on fire" {
+		t.Errorf("bad read error %v", err)
+	}
+	if token.Type != TokBad || token.Lexema != "bc" || token.Start.Col != 3 {
+		t.Errorf("bad token %+v", token)
+	}
+	if token, err := myLexer.Lex(); token.Type != TokEof || err != nil {
+		t.Errorf("after a read error got %q, %v", token.Lexema, err)
+	}
+}
+
+//noUnread is a RuneScanner that cannot unread
+type noUnread struct {
+	*strings.Reader
+}
+
+func (noUnread) UnreadRune() error {
+	return errors.New("no unread")
+}
+
+func lexemas(t *testing.T, myLexer *Lexer, n int) string {
+
+	ls := []string{}
+	for i := 0; i < n; i++ {
+		token, err := myLexer.Lex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ls = append(ls, token.Lexema)
+	}
+	return strings.Join(ls, " ")
+}
+
+func TestLookahead(t *testing.T) {
+
+	myLexer := NewLexer(noUnread{strings.NewReader("a/b//c\n0x1f<=d:=2**3 ")}, "testfile")
+	if got := lexemas(t, myLexer, 10); got != "a / b 0x1f <= d := 2 ** 3" {
+		t.Errorf("lexed %q", got)
+	}
+
+	myLexer = NewLexer(bufio.NewReader(strings.NewReader("p.x = f(a, b);")), "testfile")
+	for k, want := range []string{"p", ".", "x", "=", "f", "("} {
+		if token, err := myLexer.PeekN(k); err != nil || token.Lexema != want {
+			t.Errorf("PeekN(%d) is %q, %v, should be %q", k, token.Lexema, err, want)
+		}
+	}
+	if got := lexemas(t, myLexer, 3); got != "p . x" {
+		t.Errorf("lexed %q after peeking", got)
+	}
+	if token, _ := myLexer.PeekN(1); token.Lexema != "f" {
+		t.Errorf("PeekN(1) is %q, should be f", token.Lexema)
+	}
+}
+
+func TestMark(t *testing.T) {
+
+	myLexer := NewLexer(bufio.NewReader(strings.NewReader("a b c d e f")), "testfile")
+	myLexer.Lex()
+	outer := myLexer.Mark()
+	lexemas(t, myLexer, 1)
+	inner := myLexer.Mark()
+	if got := lexemas(t, myLexer, 2); got != "c d" {
+		t.Errorf("lexed %q after the inner mark", got)
+	}
+	myLexer.Reset(inner)
+	if got := lexemas(t, myLexer, 3); got != "c d e" {
+		t.Errorf("lexed %q after reset to the inner mark", got)
+	}
+	myLexer.Reset(outer)
+	if got := lexemas(t, myLexer, 2); got != "b c" {
+		t.Errorf("lexed %q after reset to the outer mark", got)
+	}
+
+	m := myLexer.Mark()
+	myLexer.Lex()
+	myLexer.Release(m)
+	if got := lexemas(t, myLexer, 2); got != "e f" {
+		t.Errorf("lexed %q after a release", got)
+	}
+
+	//the ring grows for long lookaheads and marks
+	text := strings.Repeat("x y z ", 100)
+	myLexer = NewLexer(bufio.NewReader(strings.NewReader(text)), "testfile")
+	m = myLexer.Mark()
+	if token, _ := myLexer.PeekN(299); token.Lexema != "z" {
+		t.Errorf("PeekN(299) is %q", token.Lexema)
+	}
+	want := strings.TrimSpace(text)
+	if got := lexemas(t, myLexer, 300); got != want {
+		t.Errorf("lexed %q", got)
+	}
+	myLexer.Reset(m)
+	if got := lexemas(t, myLexer, 300); got != want {
+		t.Errorf("lexed %q after reset", got)
+	}
+	if token, _ := myLexer.Lex(); token.Type != TokEof {
+		t.Errorf("expected EOF, got %q", token.Lexema)
+	}
+}
+
+func TestBlockComment(t *testing.T) {
+
+	texts := []struct {
+		text   string
+		nested bool
+		ids    string
+	}{
+		{"a /* b */ c", false, "a c"},
+		{"a /* b\n * c */ d\n", false, "a d"},
+		{"a /**/ b /***/ c", false, "a b c"},
+		{"a /* b /* c */ d */", false, "a d"},
+		{"a /* b /* c */ d */ e", true, "a e"},
+		{"a /* // b */ c", false, "a c"},
+	}
+	for _, txt := range texts {
+		myLexer := NewLexer(bufio.NewReader(strings.NewReader(txt.text)), "testfile")
+		myLexer.NestedComments = txt.nested
+		ids := []string{}
+		for {
+			token, _ := myLexer.Lex()
+			if token.Type == TokEof {
+				break
+			}
+			if token.Type == TokId {
+				ids = append(ids, token.Lexema)
+			}
+		}
+		if strings.Join(ids, " ") != txt.ids {
+			t.Errorf("%q (nested %v) gives %v, should be %s", txt.text, txt.nested, ids, txt.ids)
+		}
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+
+	for _, nested := range []bool{false, true} {
+		myLexer := NewLexer(bufio.NewReader(strings.NewReader("a\n  /* b /* c */\nd")), "testfile")
+		myLexer.NestedComments = nested
+		myLexer.Lex()
+		token, err := myLexer.Lex()
+		if !nested {
+			if token.Lexema != "d" || err != nil {
+				t.Errorf("not nested: token %q, %v", token.Lexema, err)
+			}
+			continue
+		}
+		var lerr *Error
+		if !errors.As(err, &lerr) || lerr.Kind != ErrUnterminatedComment ||
+			err.Error() != "testfile:2:3: Unterminated comment" {
+			t.Errorf("bad error %v", err)
+		}
+		if token.Type != TokBad {
+			t.Errorf("bad token %+v", token)
+		}
+		if token, _ := myLexer.Lex(); token.Type != TokEof {
+			t.Errorf("token after the comment %+v", token)
+		}
+	}
+}
+
+func TestDocComment(t *testing.T) {
+
+	const text = "//lost\n\n" +
+		"//first\n" +
+		"/* second\n   third */\n" +
+		"func a //not a doc\n" +
+		"b\n" +
+		"/*after b*/ c\n" +
+		"d //trailing\n" +
+		"e\n"
+	docs := map[string]string{"func": "first\nsecond\nthird", "c": "after b"}
+	myLexer := NewLexer(bufio.NewReader(strings.NewReader(text)), "testfile")
+	for {
+		token, _ := myLexer.Lex()
+		if token.Type == TokEof {
+			break
+		}
+		if doc := token.Doc.Text(); doc != docs[token.Lexema] {
+			t.Errorf("token %s has doc %q, should be %q", token.Lexema, doc, docs[token.Lexema])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package fxlex
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Position is a place in a source file. Line and Col start at 1, Col
+//and Offset count bytes. The zero Position is no position.
+type Position struct {
+	File   string
+	Line   int
+	Col    int
+	Offset int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+//String returns file:line:col, or - for no position
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+//Pos is a compact position, the file of a FileSet and the byte offset
+//in it. The zero Pos is NoPos.
+type Pos int64
+
+const NoPos Pos = 0
+
+func (p Pos) IsValid() bool {
+	return p != NoPos
+}
+
+//File is a source file known to a FileSet with its line table, the
+//offsets where each line starts. The lexer adds the lines as it reads.
+type File struct {
+	name  string
+	index int64
+	mu    sync.Mutex
+	lines []int
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+//AddLine records that a line starts at offset, lines are added in order
+func (f *File) AddLine(offset int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n := len(f.lines); n == 0 || f.lines[n-1] < offset {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+//LineCount returns the number of lines added
+func (f *File) LineCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.lines)
+}
+
+//Pos returns the compact position of the offset in the file
+func (f *File) Pos(offset int) Pos {
+	return Pos(f.index<<32 | int64(offset))
+}
+
+//Position returns the position of the offset in the file
+func (f *File) Position(offset int) Position {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	if i < 0 {
+		return Position{File: f.name, Line: 1, Col: offset + 1, Offset: offset}
+	}
+	return Position{File: f.name, Line: i + 1, Col: offset - f.lines[i] + 1, Offset: offset}
+}
+
+//FileSet is the registry of the source files of a program, so a Pos
+//can be turned into a Position by any stage
+type FileSet struct {
+	mu    sync.Mutex
+	files []*File
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+//AddFile registers a new file with its first line
+func (s *FileSet) AddFile(name string) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := &File{name: name, index: int64(len(s.files) + 1), lines: []int{0}}
+	s.files = append(s.files, f)
+	return f
+}
+
+//File returns the file of the position, nil for NoPos and positions of
+//other sets
+func (s *FileSet) File(p Pos) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := int(p >> 32)
+	if i < 1 || i > len(s.files) {
+		return nil
+	}
+	return s.files[i-1]
+}
+
+//Position returns the full position of p, the zero Position if p is not
+//of the set
+func (s *FileSet) Position(p Pos) Position {
+	f := s.File(p)
+	if f == nil {
+		return Position{}
+	}
+	return f.Position(int(p & 0xffffffff))
+}
@@ -0,0 +1,121 @@
+package fxlex
+
+//The lexer is a stream of tokens. The tokens lexed ahead by PeekN, and
+//the ones after a Mark, are kept in a ring buffer that grows as needed.
+//base is the index in the stream of the oldest token in the ring and
+//next the index of the token Lex returns.
+
+//lexed is a token of the stream with its error
+type lexed struct {
+	tok Token
+	err error
+}
+
+//tokRing is a queue of tokens in a circular buffer, it grows when full
+type tokRing struct {
+	buf   []lexed
+	first int
+	n     int
+}
+
+func (r *tokRing) push(e lexed) {
+
+	if r.n == len(r.buf) {
+		buf := make([]lexed, 2*len(r.buf)+4)
+		for i := 0; i < r.n; i++ {
+			buf[i] = r.at(i)
+		}
+		r.buf, r.first = buf, 0
+	}
+	r.buf[(r.first+r.n)%len(r.buf)] = e
+	r.n++
+}
+
+//at returns the i-th oldest token
+func (r *tokRing) at(i int) lexed {
+	return r.buf[(r.first+i)%len(r.buf)]
+}
+
+//drop removes the k oldest tokens
+func (r *tokRing) drop(k int) {
+	if k > 0 {
+		r.first = (r.first + k) % len(r.buf)
+		r.n -= k
+	}
+}
+
+//Mark is a place in the token stream to go back to
+type Mark int
+
+//PeekN returns the token k places after the next one, and its error,
+//without consuming them. PeekN(0) is Peek.
+func (l *Lexer) PeekN(k int) (Token, error) {
+
+	for l.base+l.toks.n <= l.next+k {
+		t, err := l.scan()
+		l.attachDoc(&t)
+		l.toks.push(lexed{tok: t, err: err})
+	}
+	e := l.toks.at(l.next + k - l.base)
+	return e.tok, e.err
+}
+
+//Peek returns the next token and its error without consuming them,
+//the next Lex returns them again
+func (l *Lexer) Peek() (Token, error) {
+	return l.PeekN(0)
+}
+
+//Lex returns the next token. On errors it is a *Error and the token is
+//the TokBad with the text that could not be lexed, but for bad number
+//literals, which are TokValInt of value 0. After a read error the lexer
+//returns TokEof.
+func (l *Lexer) Lex() (Token, error) {
+
+	t, err := l.PeekN(0)
+	l.next++
+	l.trim()
+	return t, err
+}
+
+//trim drops the tokens that are behind the next one and every mark
+func (l *Lexer) trim() {
+
+	low := l.next
+	if len(l.marks) > 0 {
+		low = l.marks[0]
+	}
+	l.toks.drop(low - l.base)
+	l.base = low
+}
+
+//Mark returns the place of the next token, to come back with Reset.
+//Marks nest: they are reset or released in the reverse order they are
+//made.
+func (l *Lexer) Mark() Mark {
+	l.marks = append(l.marks, l.next)
+	return Mark(l.next)
+}
+
+func (l *Lexer) unmark(m Mark) {
+
+	n := len(l.marks)
+	if n == 0 || l.marks[n-1] != int(m) {
+		panic("fxlex: marks released out of order")
+	}
+	l.marks = l.marks[:n-1]
+}
+
+//Reset goes back to the mark m, the tokens after it are lexed again
+//from the buffer
+func (l *Lexer) Reset(m Mark) {
+	l.unmark(m)
+	l.next = int(m)
+	l.trim()
+}
+
+//Release forgets the mark m, staying at the current token
+func (l *Lexer) Release(m Mark) {
+	l.unmark(m)
+	l.trim()
+}
@@ -0,0 +1,247 @@
+package fxopt
+
+import (
+	"fmt"
+	"fxinterp"
+	"fxlex"
+	"fxparser"
+	"fxsym"
+	"strconv"
+)
+
+//Fold replaces the constant expressions of a program without errors, as
+//returned by fxparser.Parse, with their value and simplifies the bool
+//identities:
+//	x | True is True, x | False is x
+//	x & False is False, x & True is x
+//	x ^ False is x, x ^ True is !x
+//and [a, b].x is a. An expression is only dropped if it cannot fail at
+//run time (it has no / % or **).
+//
+//It returns the errors found while evaluating: division by zero,
+//negative exponents and iter steps of 0.
+
+type folder struct {
+	prog *fxparser.Program
+	errs []error
+}
+
+func Fold(prog *fxparser.Program) []error {
+
+	f := &folder{prog: prog}
+	for _, fn := range prog.Funcs {
+		f.block(fn.Body)
+	}
+	return f.errs
+}
+
+func (f *folder) errAt(tok fxlex.Token, message string, place string) {
+	f.errs = append(f.errs, fmt.Errorf("%s: %s %s", tok.Start, message, place))
+}
+
+func (f *folder) block(block *fxparser.Block) {
+	for _, stmt := range block.Stmts {
+		f.stmt(stmt)
+	}
+}
+
+func (f *folder) stmt(stmt fxparser.Stmt) {
+
+	switch stmt := stmt.(type) {
+	case *fxparser.AssignStmt:
+		stmt.Value = f.expr(stmt.Value)
+	case *fxparser.CallStmt:
+		for i, arg := range stmt.Args {
+			stmt.Args[i] = f.expr(arg)
+		}
+	case *fxparser.IterStmt:
+		stmt.Start = f.expr(stmt.Start)
+		stmt.End = f.expr(stmt.End)
+		stmt.Step = f.expr(stmt.Step)
+		if step, ok := stmt.Step.(*fxparser.IntLit); ok && step.Value == 0 {
+			f.errAt(step.Tok, "Iter step is 0", "in iter statement")
+		}
+		f.block(stmt.Body)
+	case *fxparser.IfStmt:
+		stmt.Cond = f.expr(stmt.Cond)
+		f.block(stmt.Then)
+		if stmt.Else != nil {
+			f.stmt(stmt.Else)
+		}
+	case *fxparser.Block:
+		f.block(stmt)
+	}
+}
+
+//intLit and boolLit make the literal for the value of the expression
+//at tok
+func (f *folder) intLit(tok fxlex.Token, v int64) fxparser.Expr {
+	tok.Type, tok.Lexema, tok.TokValInt = fxlex.TokValInt, strconv.FormatInt(v, 10), v
+	lit := &fxparser.IntLit{Tok: tok, Value: v}
+	f.prog.Types[lit] = fxsym.TypeInt
+	return lit
+}
+
+func (f *folder) boolLit(tok fxlex.Token, v bool) fxparser.Expr {
+	tok.Type, tok.Lexema, tok.TokValBool = fxlex.TokValBool, "False", v
+	if v {
+		tok.Lexema = "True"
+	}
+	lit := &fxparser.BoolLit{Tok: tok, Value: v}
+	f.prog.Types[lit] = fxsym.TypeBool
+	return lit
+}
+
+//canFail tells if evaluating the expression may be an error
+func canFail(expr fxparser.Expr) bool {
+
+	switch expr := expr.(type) {
+	case *fxparser.UnaryExpr:
+		return canFail(expr.X)
+	case *fxparser.BinaryExpr:
+		switch expr.Op {
+		case fxlex.TokType('/'), fxlex.TokType('%'), fxlex.TokDMul:
+			return true
+		}
+		return canFail(expr.X) || canFail(expr.Y)
+	case *fxparser.SelectorExpr:
+		return canFail(expr.X)
+	case *fxparser.CoordLit:
+		return canFail(expr.X) || canFail(expr.Y)
+	}
+	return false
+}
+
+func (f *folder) expr(expr fxparser.Expr) fxparser.Expr {
+
+	switch expr := expr.(type) {
+	case *fxparser.CoordLit:
+		expr.X = f.expr(expr.X)
+		expr.Y = f.expr(expr.Y)
+	case *fxparser.SelectorExpr:
+		expr.X = f.expr(expr.X)
+		lit, ok := expr.X.(*fxparser.CoordLit)
+		if !ok {
+			return expr
+		}
+		if expr.Sel.Name == "x" && !canFail(lit.Y) {
+			return lit.X
+		}
+		if expr.Sel.Name == "y" && !canFail(lit.X) {
+			return lit.Y
+		}
+	case *fxparser.UnaryExpr:
+		expr.X = f.expr(expr.X)
+		switch x := expr.X.(type) {
+		case *fxparser.IntLit:
+			switch expr.Op {
+			case fxlex.TokType('-'):
+				return f.intLit(expr.Tok, -x.Value)
+			case fxlex.TokType('+'):
+				return f.intLit(expr.Tok, x.Value)
+			}
+		case *fxparser.BoolLit:
+			return f.boolLit(expr.Tok, !x.Value)
+		}
+	case *fxparser.BinaryExpr:
+		expr.X = f.expr(expr.X)
+		expr.Y = f.expr(expr.Y)
+		return f.binary(expr)
+	}
+	return expr
+}
+
+func (f *folder) binary(expr *fxparser.BinaryExpr) fxparser.Expr {
+
+	if x, ok := expr.X.(*fxparser.IntLit); ok {
+		if y, ok := expr.Y.(*fxparser.IntLit); ok {
+			return f.intOp(expr, x.Value, y.Value)
+		}
+		return expr
+	}
+	//the divisor alone may be a constant 0
+	if y, ok := expr.Y.(*fxparser.IntLit); ok && y.Value == 0 {
+		switch expr.Op {
+		case fxlex.TokType('/'), fxlex.TokType('%'):
+			f.errAt(expr.Tok, "Division by zero", "in expression")
+			return expr
+		}
+	}
+
+	x, xok := expr.X.(*fxparser.BoolLit)
+	y, yok := expr.Y.(*fxparser.BoolLit)
+	if xok && yok {
+		switch expr.Op {
+		case fxlex.TokType('|'):
+			return f.boolLit(expr.Tok, x.Value || y.Value)
+		case fxlex.TokType('&'):
+			return f.boolLit(expr.Tok, x.Value && y.Value)
+		case fxlex.TokType('^'):
+			return f.boolLit(expr.Tok, x.Value != y.Value)
+		case fxlex.TokEqual:
+			return f.boolLit(expr.Tok, x.Value == y.Value)
+		}
+		return expr
+	}
+
+	//identities, other is the operand that is not a literal
+	lit, other := x, expr.Y
+	if yok {
+		lit, other = y, expr.X
+	}
+	if lit == nil {
+		return expr
+	}
+	switch {
+	case expr.Op == fxlex.TokType('|') && lit.Value, expr.Op == fxlex.TokType('&') && !lit.Value:
+		if !canFail(other) {
+			return f.boolLit(expr.Tok, lit.Value)
+		}
+	case expr.Op == fxlex.TokType('|'), expr.Op == fxlex.TokType('&'), expr.Op == fxlex.TokType('^') && !lit.Value:
+		return other
+	case expr.Op == fxlex.TokType('^'):
+		not := &fxparser.UnaryExpr{Tok: expr.Tok, Op: fxlex.TokType('!'), X: other}
+		not.Tok.Type, not.Tok.Lexema = fxlex.TokType('!'), "!"
+		f.prog.Types[not] = fxsym.TypeBool
+		return not
+	}
+	return expr
+}
+
+func (f *folder) intOp(expr *fxparser.BinaryExpr, x, y int64) fxparser.Expr {
+
+	switch expr.Op {
+	case fxlex.TokType('+'):
+		return f.intLit(expr.Tok, x+y)
+	case fxlex.TokType('-'):
+		return f.intLit(expr.Tok, x-y)
+	case fxlex.TokType('*'):
+		return f.intLit(expr.Tok, x*y)
+	case fxlex.TokType('/'), fxlex.TokType('%'):
+		if y == 0 {
+			f.errAt(expr.Tok, "Division by zero", "in constant expression")
+			return expr
+		}
+		if expr.Op == fxlex.TokType('/') {
+			return f.intLit(expr.Tok, x/y)
+		}
+		return f.intLit(expr.Tok, x%y)
+	case fxlex.TokDMul:
+		if y < 0 {
+			f.errAt(expr.Tok, "Negative exponent", "in constant expression")
+			return expr
+		}
+		return f.intLit(expr.Tok, fxinterp.Pow(x, y))
+	case fxlex.TokType('<'):
+		return f.boolLit(expr.Tok, x < y)
+	case fxlex.TokType('>'):
+		return f.boolLit(expr.Tok, x > y)
+	case fxlex.TokSmaller:
+		return f.boolLit(expr.Tok, x <= y)
+	case fxlex.TokGreater:
+		return f.boolLit(expr.Tok, x >= y)
+	case fxlex.TokEqual:
+		return f.boolLit(expr.Tok, x == y)
+	}
+	return expr
+}
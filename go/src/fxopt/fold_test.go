@@ -0,0 +1,114 @@
+package fxopt_test
+
+import (
+	"context"
+	"fxcanvas"
+	"fxinterp"
+	"fxlex"
+	. "fxopt"
+	"fxparser"
+	"fxsym"
+	"fxtest"
+	"strings"
+	"testing"
+)
+
+func draw(t *testing.T, prog *fxparser.Program) string {
+
+	rec := &fxcanvas.Recorder{}
+	if err := fxinterp.New(prog, rec).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(rec.Strings(), "\n")
+}
+
+func TestFold(t *testing.T) {
+
+	const text = "func main(){\n" +
+		"  int a;\n" +
+		"  bool b;\n" +
+		"  a = 0x10 + 2 ** 3 * (5 - 1) % 7;\n" +
+		"  b = a > 3 | True;\n" +
+		"  b = (a > 3) ^ True;\n" +
+		"  b = False | a == 2 & !False;\n" +
+		"  b = (1 / a == 0) | True;\n" +
+		"  circle([-(3 - 4), [a, 2].y], 0x1f, 0x1100001f);\n" +
+		"  iter (i := 0, 3 - 1, 2 - 1){\n" +
+		"    rect([a, i], 5, 0xff);\n" +
+		"  }\n" +
+		"}\n"
+
+	want := draw(t, fxtest.Parse(t, "opt_test.fx", text))
+	prog := fxtest.Parse(t, "opt_test.fx", text)
+	if errs := Fold(prog); errs != nil {
+		t.Fatal(errs)
+	}
+	if got := draw(t, prog); got != want {
+		t.Errorf("folded program drew\n%s\nshould be\n%s", got, want)
+	}
+
+	stmts := prog.Func("main").Body.Stmts
+	value := func(i int) fxparser.Expr {
+		return stmts[i].(*fxparser.AssignStmt).Value
+	}
+	if lit, ok := value(2).(*fxparser.IntLit); !ok || lit.Value != 20 || lit.Tok.Line != 4 {
+		t.Errorf("bad int folding: %#v", value(2))
+	}
+	if lit, ok := value(3).(*fxparser.BoolLit); !ok || !lit.Value {
+		t.Errorf("x | True is %#v", value(3))
+	}
+	if not, ok := value(4).(*fxparser.UnaryExpr); !ok || not.Op != fxlex.TokType('!') || prog.TypeOf(not) != fxsym.TypeBool {
+		t.Errorf("x ^ True is %#v", value(4))
+	}
+	if eq, ok := value(5).(*fxparser.BinaryExpr); !ok || eq.Op != fxlex.TokEqual {
+		t.Errorf("False | x & !False is %#v", value(5))
+	}
+	if _, ok := value(6).(*fxparser.BinaryExpr); !ok {
+		t.Errorf("x | True was folded with a division: %#v", value(6))
+	}
+	call := stmts[7].(*fxparser.CallStmt)
+	coord := call.Args[0].(*fxparser.CoordLit)
+	if x, ok := coord.X.(*fxparser.IntLit); !ok || x.Value != 1 {
+		t.Errorf("bad unary folding: %#v", coord.X)
+	}
+	if y, ok := coord.Y.(*fxparser.IntLit); !ok || y.Value != 2 {
+		t.Errorf("bad selector folding: %#v", coord.Y)
+	}
+	if c, ok := call.Args[2].(*fxparser.IntLit); !ok || c.Value != 0x1100001f {
+		t.Errorf("bad hex literal: %#v", call.Args[2])
+	}
+	iter := stmts[8].(*fxparser.IterStmt)
+	if end, ok := iter.End.(*fxparser.IntLit); !ok || end.Value != 2 || prog.TypeOf(end) != fxsym.TypeInt {
+		t.Errorf("bad iter bound: %#v", iter.End)
+	}
+}
+
+func TestFoldErrors(t *testing.T) {
+
+	const text = "func main(){\n" +
+		"  int a;\n" +
+		"  a = 3 / (2 - 2);\n" +
+		"  a = [1, a % 0].x;\n" +
+		"  iter (i := 0, 3, 1 - 1){\n" +
+		"    a = 2 ** (0 - 1);\n" +
+		"  }\n" +
+		"  a = a / (2 - 2);\n" +
+		"}\n"
+
+	errs := Fold(fxtest.Parse(t, "opt_test.fx", text))
+	wanted := []string{
+		"opt_test.fx:3:9: Division by zero in constant expression",
+		"opt_test.fx:4:13: Division by zero in expression",
+		"opt_test.fx:5:22: Iter step is 0 in iter statement",
+		"opt_test.fx:6:11: Negative exponent in constant expression",
+		"opt_test.fx:8:9: Division by zero in expression",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+}
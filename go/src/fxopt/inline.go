@@ -0,0 +1,268 @@
+package fxopt
+
+import (
+	"fmt"
+	"fxlex"
+	"fxparser"
+	"fxsym"
+	"strings"
+)
+
+//Inline expands every call to a user func into main, main is left as
+//the only func of the program. A call becomes the declarations of the
+//parameters, their assignment and the statements of the body. The
+//parameters and the locals of the inlined funcs get new names, x_1,
+//x_2..., that are not used anywhere in the program, so they never hide
+//the variables of the caller.
+//
+//fx funcs cannot be recursive, a call chain that gets back to a func
+//is an error. So is nesting the calls more than MaxInlineDepth or
+//making main longer than MaxInlineStmts statements.
+//
+//The scopes of the program are not updated, the symbols of the new
+//names are in the tree and in the types of prog.
+
+const (
+	MaxInlineDepth = 100
+	MaxInlineStmts = 100000
+)
+
+type inliner struct {
+	prog  *fxparser.Program
+	funcs map[*fxsym.Sym]*fxparser.FuncDecl
+	used  map[string]bool
+	nstmt int
+	errs  []error
+}
+
+//errTooBig stops the expansion when main is too long
+type errTooBig struct{}
+
+func Inline(prog *fxparser.Program) (errs []error) {
+
+	main := prog.Func("main")
+	if main == nil {
+		return []error{fmt.Errorf("%s: No function main", prog.Tok.File)}
+	}
+
+	in := &inliner{prog: prog, funcs: map[*fxsym.Sym]*fxparser.FuncDecl{}, used: map[string]bool{}}
+	for _, fn := range prog.Funcs {
+		in.funcs[fn.Sym] = fn
+	}
+	for _, sym := range prog.Scope.Syms() {
+		in.used[sym.Name] = true
+	}
+	for s := prog.Scope.Outer; s != nil; s = s.Outer {
+		for _, sym := range s.Syms() {
+			in.used[sym.Name] = true
+		}
+	}
+	for _, fn := range prog.Funcs {
+		in.names(fn)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errTooBig); !ok {
+				panic(r)
+			}
+			errs = in.errs
+		}
+	}()
+
+	body := &fxparser.Block{Tok: main.Body.Tok}
+	body.Stmts = in.block(main.Body, map[*fxsym.Sym]*fxsym.Sym{}, []string{main.Name})
+	main.Body = body
+	prog.Funcs = []*fxparser.FuncDecl{main}
+	return in.errs
+}
+
+//names marks the names declared in fn as used
+func (in *inliner) names(fn *fxparser.FuncDecl) {
+
+	for _, p := range fn.Params {
+		in.used[p.Name] = true
+	}
+	var stmts func(block *fxparser.Block)
+	stmts = func(block *fxparser.Block) {
+		for _, stmt := range block.Stmts {
+			switch stmt := stmt.(type) {
+			case *fxparser.VarDecl:
+				in.used[stmt.Name] = true
+			case *fxparser.IterStmt:
+				in.used[stmt.Var.Name] = true
+				stmts(stmt.Body)
+			case *fxparser.IfStmt:
+				for s := fxparser.Stmt(stmt); s != nil; {
+					switch els := s.(type) {
+					case *fxparser.IfStmt:
+						stmts(els.Then)
+						s = els.Else
+					case *fxparser.Block:
+						stmts(els)
+						s = nil
+					}
+				}
+			}
+		}
+	}
+	stmts(fn.Body)
+}
+
+//rename returns a new symbol for sym with a name not used yet
+func (in *inliner) rename(sym *fxsym.Sym) *fxsym.Sym {
+
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s_%d", sym.Name, n)
+		if !in.used[name] {
+			in.used[name] = true
+			s := *sym
+			s.Name = name
+			return &s
+		}
+	}
+}
+
+func (in *inliner) emit(stmts []fxparser.Stmt, stmt fxparser.Stmt) []fxparser.Stmt {
+
+	in.nstmt++
+	if in.nstmt > MaxInlineStmts {
+		tok := stmt.Token()
+		in.errs = append(in.errs, fmt.Errorf("%s: Expanded program too big (more than %d statements)",
+			tok.Start, MaxInlineStmts))
+		panic(errTooBig{})
+	}
+	return append(stmts, stmt)
+}
+
+//block copies the statements of block, the variables in subst are
+//renamed. stack is the chain of calls being expanded.
+func (in *inliner) block(block *fxparser.Block, subst map[*fxsym.Sym]*fxsym.Sym, stack []string) []fxparser.Stmt {
+
+	stmts := []fxparser.Stmt{}
+	for _, stmt := range block.Stmts {
+		if call, ok := stmt.(*fxparser.CallStmt); ok && call.Sym.Kind == fxsym.SFunc {
+			stmts = in.call(stmts, call, subst, stack)
+			continue
+		}
+		stmts = in.emit(stmts, in.stmt(stmt, subst, stack))
+	}
+	return stmts
+}
+
+func (in *inliner) newBlock(block *fxparser.Block, subst map[*fxsym.Sym]*fxsym.Sym, stack []string) *fxparser.Block {
+	return &fxparser.Block{Tok: block.Tok, Stmts: in.block(block, subst, stack)}
+}
+
+//call appends the expansion of the call to stmts
+func (in *inliner) call(stmts []fxparser.Stmt, call *fxparser.CallStmt, subst map[*fxsym.Sym]*fxsym.Sym, stack []string) []fxparser.Stmt {
+
+	fn := in.funcs[call.Sym]
+	chain := strings.Join(append(stack, fn.Name), " -> ")
+	for _, name := range stack {
+		if name == fn.Name {
+			in.errs = append(in.errs, fmt.Errorf("%s: Recursive call to %s in %s", call.Tok.Start, fn.Name, chain))
+			return stmts
+		}
+	}
+	if len(stack) >= MaxInlineDepth {
+		in.errs = append(in.errs, fmt.Errorf("%s: Call to %s nested too deep (more than %d calls) in %s",
+			call.Tok.Start, fn.Name, MaxInlineDepth, chain))
+		return stmts
+	}
+
+	inner := map[*fxsym.Sym]*fxsym.Sym{}
+	for i, param := range fn.Params {
+		sym := in.rename(param.Sym)
+		inner[param.Sym] = sym
+		decl := &fxparser.VarDecl{Tok: renamed(param.Tok, sym), Name: sym.Name, TypeTok: param.TypeTok, TypeName: param.TypeName, Sym: sym}
+		stmts = in.emit(stmts, decl)
+
+		eq := call.Tok
+		eq.Type, eq.Lexema = fxlex.TokType('='), "="
+		target := in.ident(&fxparser.Ident{Tok: param.Tok, Name: param.Name, Sym: param.Sym}, inner)
+		assign := &fxparser.AssignStmt{Tok: eq, Target: target, Value: in.expr(call.Args[i], subst)}
+		stmts = in.emit(stmts, assign)
+	}
+	return append(stmts, in.block(fn.Body, inner, append(stack[:len(stack):len(stack)], fn.Name))...)
+}
+
+func renamed(tok fxlex.Token, sym *fxsym.Sym) fxlex.Token {
+	tok.Lexema, tok.TokValString = sym.Name, sym.Name
+	return tok
+}
+
+//stmt copies a statement that is not a call to a user func
+func (in *inliner) stmt(stmt fxparser.Stmt, subst map[*fxsym.Sym]*fxsym.Sym, stack []string) fxparser.Stmt {
+
+	//the locals of inlined funcs are renamed, not the ones of main
+	inlined := len(stack) > 1
+	switch stmt := stmt.(type) {
+	case *fxparser.VarDecl:
+		if !inlined {
+			return stmt
+		}
+		sym := in.rename(stmt.Sym)
+		subst[stmt.Sym] = sym
+		return &fxparser.VarDecl{Tok: renamed(stmt.Tok, sym), Name: sym.Name, TypeTok: stmt.TypeTok, TypeName: stmt.TypeName, Sym: sym}
+	case *fxparser.AssignStmt:
+		return &fxparser.AssignStmt{Tok: stmt.Tok, Target: in.expr(stmt.Target, subst), Value: in.expr(stmt.Value, subst)}
+	case *fxparser.CallStmt:
+		call := &fxparser.CallStmt{Tok: stmt.Tok, Name: stmt.Name, Sym: stmt.Sym}
+		for _, a := range stmt.Args {
+			call.Args = append(call.Args, in.expr(a, subst))
+		}
+		return call
+	case *fxparser.IterStmt:
+		iter := &fxparser.IterStmt{Tok: stmt.Tok, Start: in.expr(stmt.Start, subst), End: in.expr(stmt.End, subst), Step: in.expr(stmt.Step, subst)}
+		if inlined {
+			subst[stmt.Var.Sym] = in.rename(stmt.Var.Sym)
+		}
+		iter.Var = in.ident(stmt.Var, subst)
+		iter.Body = in.newBlock(stmt.Body, subst, stack)
+		return iter
+	case *fxparser.IfStmt:
+		ifs := &fxparser.IfStmt{Tok: stmt.Tok, Cond: in.expr(stmt.Cond, subst), Then: in.newBlock(stmt.Then, subst, stack)}
+		if stmt.Else != nil {
+			ifs.Else = in.stmt(stmt.Else, subst, stack)
+		}
+		return ifs
+	case *fxparser.Block:
+		return in.newBlock(stmt, subst, stack)
+	}
+	return stmt
+}
+
+func (in *inliner) ident(id *fxparser.Ident, subst map[*fxsym.Sym]*fxsym.Sym) *fxparser.Ident {
+
+	n := &fxparser.Ident{Tok: id.Tok, Name: id.Name, Sym: id.Sym}
+	if sym, ok := subst[id.Sym]; ok {
+		n.Tok, n.Name, n.Sym = renamed(id.Tok, sym), sym.Name, sym
+	}
+	in.prog.Types[n] = n.Sym.Type
+	return n
+}
+
+//expr copies the expression with the variables in subst renamed
+func (in *inliner) expr(expr fxparser.Expr, subst map[*fxsym.Sym]*fxsym.Sym) fxparser.Expr {
+
+	var n fxparser.Expr
+	switch expr := expr.(type) {
+	case *fxparser.Ident:
+		return in.ident(expr, subst)
+	case *fxparser.IntLit, *fxparser.BoolLit:
+		return expr
+	case *fxparser.CoordLit:
+		n = &fxparser.CoordLit{Tok: expr.Tok, X: in.expr(expr.X, subst), Y: in.expr(expr.Y, subst)}
+	case *fxparser.SelectorExpr:
+		n = &fxparser.SelectorExpr{Tok: expr.Tok, X: in.expr(expr.X, subst), Sel: expr.Sel}
+	case *fxparser.UnaryExpr:
+		n = &fxparser.UnaryExpr{Tok: expr.Tok, Op: expr.Op, X: in.expr(expr.X, subst)}
+	case *fxparser.BinaryExpr:
+		n = &fxparser.BinaryExpr{Tok: expr.Tok, Op: expr.Op, X: in.expr(expr.X, subst), Y: in.expr(expr.Y, subst)}
+	default:
+		return expr
+	}
+	in.prog.Types[n] = in.prog.Types[expr]
+	return n
+}
@@ -0,0 +1,144 @@
+package fxopt_test
+
+import (
+	"bufio"
+	"fmt"
+	"fxlex"
+	. "fxopt"
+	"fxparser"
+	"fxtest"
+	"strings"
+	"testing"
+)
+
+func TestInline(t *testing.T) {
+
+	const text = "func dot(Coord p, int c){\n" +
+		"  int r;\n" +
+		"  r = c * 2;\n" +
+		"  circle(p, r, c);\n" +
+		"}\n" +
+		"func two(int r){\n" +
+		"  dot([r, r], r);\n" +
+		"  if (r > 1) {\n" +
+		"    dot([0, r], 1);\n" +
+		"  }\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  int r;\n" +
+		"  r = 3;\n" +
+		"  dot([r, 1], r + 1);\n" +
+		"  iter (i := 0, 1, 1){\n" +
+		"    two(i + r);\n" +
+		"  }\n" +
+		"}\n"
+	const want = "func main(){\n" +
+		"\tint r;\n" +
+		"\tr = 3;\n" +
+		"\tCoord p_1;\n" +
+		"\tp_1 = [r, 1];\n" +
+		"\tint c_1;\n" +
+		"\tc_1 = r + 1;\n" +
+		"\tint r_1;\n" +
+		"\tr_1 = c_1 * 2;\n" +
+		"\tcircle(p_1, r_1, c_1);\n" +
+		"\titer (i := 0, 1, 1){\n" +
+		"\t\tint r_2;\n" +
+		"\t\tr_2 = i + r;\n" +
+		"\t\tCoord p_2;\n" +
+		"\t\tp_2 = [r_2, r_2];\n" +
+		"\t\tint c_2;\n" +
+		"\t\tc_2 = r_2;\n" +
+		"\t\tint r_3;\n" +
+		"\t\tr_3 = c_2 * 2;\n" +
+		"\t\tcircle(p_2, r_3, c_2);\n" +
+		"\t\tif (r_2 > 1) {\n" +
+		"\t\t\tCoord p_3;\n" +
+		"\t\t\tp_3 = [0, r_2];\n" +
+		"\t\t\tint c_3;\n" +
+		"\t\t\tc_3 = 1;\n" +
+		"\t\t\tint r_4;\n" +
+		"\t\t\tr_4 = c_3 * 2;\n" +
+		"\t\t\tcircle(p_3, r_4, c_3);\n" +
+		"\t\t}\n" +
+		"\t}\n" +
+		"}\n"
+
+	wantDraw := draw(t, fxtest.Parse(t, "opt_test.fx", text))
+	prog := fxtest.Parse(t, "opt_test.fx", text)
+	if errs := Inline(prog); errs != nil {
+		t.Fatal(errs)
+	}
+	if len(prog.Funcs) != 1 || prog.Funcs[0].Name != "main" {
+		t.Fatalf("inlined program has funcs %v", prog.Funcs)
+	}
+	if got := draw(t, prog); got != wantDraw {
+		t.Errorf("inlined program drew\n%s\nshould be\n%s", got, wantDraw)
+	}
+
+	var out strings.Builder
+	if err := fxparser.Fprint(&out, prog); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("inlined program is\n%s\nshould be\n%s", out.String(), want)
+	}
+	if got := draw(t, fxtest.Parse(t, "opt_test.fx", out.String())); got != wantDraw {
+		t.Errorf("printed program drew\n%s\nshould be\n%s", got, wantDraw)
+	}
+}
+
+func TestInlineErrors(t *testing.T) {
+
+	const text = "func a(int n){\n" +
+		"  b(n);\n" +
+		"}\n" +
+		"func b(int n){\n" +
+		"  circle([n, n], n, n);\n" +
+		"  a(n - 1);\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  a(3);\n" +
+		"  b(1);\n" +
+		"}\n"
+
+	//Parse reports the cycle, Inline does not expand it either
+	p := fxparser.NewParser(fxlex.NewLexer(bufio.NewReader(strings.NewReader(text)), "opt_test.fx"))
+	p.DebugDesc = false
+	prog, errs := p.Parse()
+	if len(errs) != 1 || errs[0].Error() != "opt_test.fx:2:3: Recursive call to b in cycle a -> b -> a" {
+		t.Fatalf("bad parse errors: %v", errs)
+	}
+	errs = Inline(prog)
+	wanted := []string{
+		"opt_test.fx:6:3: Recursive call to a in main -> a -> b -> a",
+		"opt_test.fx:2:3: Recursive call to b in main -> b -> a -> b",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestInlineLimits(t *testing.T) {
+
+	if errs := Inline(fxtest.Parse(t, "opt_test.fx", fxtest.Chain(MaxInlineDepth-1, 1))); errs != nil {
+		t.Errorf("inlining %d nested calls: %v", MaxInlineDepth-1, errs)
+	}
+	errs := Inline(fxtest.Parse(t, "opt_test.fx", fxtest.Chain(MaxInlineDepth, 1)))
+	want := fmt.Sprintf("Call to f%d nested too deep (more than %d calls) in main -> f1 -> f2", MaxInlineDepth, MaxInlineDepth)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), want) {
+		t.Errorf("expected a too deep error, got %v", errs)
+	}
+
+	//2**17 circles
+	errs = Inline(fxtest.Parse(t, "opt_test.fx", fxtest.Chain(18, 2)))
+	want = fmt.Sprintf("Expanded program too big (more than %d statements)", MaxInlineStmts)
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].Error(), want) {
+		t.Errorf("expected a too big error, got %v", errs)
+	}
+}
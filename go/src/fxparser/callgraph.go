@@ -0,0 +1,327 @@
+package fxparser
+
+import (
+	"bufio"
+	"fmt"
+	"fxlex"
+	"fxsym"
+	"io"
+	"strings"
+)
+
+//CallGraph tells which funcs call which. It is built from the tree by
+//name, so it works on programs with errors too: a call is bound to the
+//first func declared with its name. The calls to builtins are kept
+//apart, the calls to undeclared funcs are not in the graph.
+//
+//fx macros are expanded, so they cannot be recursive, and a program
+//runs from main. Parse reports the cycles, Errors reports them too with
+//the funcs that main never calls and a missing or repeated main.
+type CallGraph struct {
+	Prog *Program
+	//the calls to funcs made in the body of each func, in order
+	Calls    map[*FuncDecl][]*CallStmt
+	builtins map[*FuncDecl][]string
+	funcs    map[string]*FuncDecl
+}
+
+//Cycle is a chain of calls from a func back to itself, Funcs starts and
+//ends with the same func and Call is the call that closes the cycle
+type Cycle struct {
+	Funcs []*FuncDecl
+	Call  *CallStmt
+}
+
+func (c Cycle) String() string {
+	names := []string{}
+	for _, fn := range c.Funcs {
+		names = append(names, fn.Name)
+	}
+	return strings.Join(names, " -> ")
+}
+
+func NewCallGraph(prog *Program) *CallGraph {
+
+	g := &CallGraph{Prog: prog, Calls: map[*FuncDecl][]*CallStmt{},
+		builtins: map[*FuncDecl][]string{}, funcs: map[string]*FuncDecl{}}
+	for _, fn := range prog.Funcs {
+		if g.funcs[fn.Name] == nil {
+			g.funcs[fn.Name] = fn
+		}
+	}
+	for _, fn := range prog.Funcs {
+		if fn.Body == nil {
+			continue
+		}
+		walkCalls(fn.Body, func(call *CallStmt) {
+			switch {
+			case g.funcs[call.Name] != nil:
+				g.Calls[fn] = append(g.Calls[fn], call)
+			case isBuiltin(call.Name) && !contains(g.builtins[fn], call.Name):
+				g.builtins[fn] = append(g.builtins[fn], call.Name)
+			}
+		})
+	}
+	return g
+}
+
+//isBuiltin tells if the name is of a builtin procedure, a func declared
+//with the same name hides it
+func isBuiltin(name string) bool {
+	for _, b := range fxsym.Builtins {
+		if b.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+//walkCalls calls f for each call statement in the block, in order
+func walkCalls(block *Block, f func(call *CallStmt)) {
+
+	for _, stmt := range block.Stmts {
+		for stmt != nil {
+			switch s := stmt.(type) {
+			case *CallStmt:
+				f(s)
+				stmt = nil
+			case *IterStmt:
+				walkCalls(s.Body, f)
+				stmt = nil
+			case *IfStmt:
+				walkCalls(s.Then, f)
+				stmt = s.Else
+			case *Block:
+				walkCalls(s, f)
+				stmt = nil
+			default:
+				stmt = nil
+			}
+		}
+	}
+}
+
+//Callee returns the func called, nil for builtins and undeclared funcs
+func (g *CallGraph) Callee(call *CallStmt) *FuncDecl {
+	return g.funcs[call.Name]
+}
+
+//Callees returns the funcs called by fn, each one once, in the order of
+//their first call
+func (g *CallGraph) Callees(fn *FuncDecl) []*FuncDecl {
+
+	callees := []*FuncDecl{}
+	seen := map[*FuncDecl]bool{}
+	for _, call := range g.Calls[fn] {
+		if callee := g.Callee(call); !seen[callee] {
+			seen[callee] = true
+			callees = append(callees, callee)
+		}
+	}
+	return callees
+}
+
+//Mains returns the funcs named main, there should be exactly one
+func (g *CallGraph) Mains() []*FuncDecl {
+
+	mains := []*FuncDecl{}
+	for _, fn := range g.Prog.Funcs {
+		if fn.Name == "main" {
+			mains = append(mains, fn)
+		}
+	}
+	return mains
+}
+
+//Reachable returns the funcs called from main, directly or not, main
+//included
+func (g *CallGraph) Reachable() map[*FuncDecl]bool {
+
+	reached := map[*FuncDecl]bool{}
+	var visit func(fn *FuncDecl)
+	visit = func(fn *FuncDecl) {
+		if reached[fn] {
+			return
+		}
+		reached[fn] = true
+		for _, callee := range g.Callees(fn) {
+			visit(callee)
+		}
+	}
+	if main := g.funcs["main"]; main != nil {
+		visit(main)
+	}
+	return reached
+}
+
+//Unreachable returns the funcs that are not reachable from main, in the
+//order they are declared. Without main there are none, and the funcs
+//declared again are not counted.
+func (g *CallGraph) Unreachable() []*FuncDecl {
+
+	unreached := []*FuncDecl{}
+	if g.funcs["main"] == nil {
+		return unreached
+	}
+	reached := g.Reachable()
+	for _, fn := range g.Prog.Funcs {
+		if !reached[fn] && g.funcs[fn.Name] == fn {
+			unreached = append(unreached, fn)
+		}
+	}
+	return unreached
+}
+
+//Cycles returns the recursive chains of calls found going depth first
+//through the funcs in the order they are declared. Every call that gets
+//back to a func of the current chain closes one cycle.
+func (g *CallGraph) Cycles() []Cycle {
+
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := map[*FuncDecl]int{}
+	path := []*FuncDecl{}
+	cycles := []Cycle{}
+
+	var visit func(fn *FuncDecl)
+	visit = func(fn *FuncDecl) {
+		state[fn] = onPath
+		path = append(path, fn)
+		for _, call := range g.Calls[fn] {
+			callee := g.Callee(call)
+			switch state[callee] {
+			case unvisited:
+				visit(callee)
+			case onPath:
+				start := len(path) - 1
+				for path[start] != callee {
+					start--
+				}
+				funcs := append(append([]*FuncDecl{}, path[start:]...), callee)
+				cycles = append(cycles, Cycle{Funcs: funcs, Call: call})
+			}
+		}
+		path = path[:len(path)-1]
+		state[fn] = done
+	}
+	for _, fn := range g.Prog.Funcs {
+		if state[fn] == unvisited && g.funcs[fn.Name] == fn {
+			visit(fn)
+		}
+	}
+	return cycles
+}
+
+//call returns the first call from fn to callee
+func (g *CallGraph) call(fn, callee *FuncDecl) *CallStmt {
+
+	for _, call := range g.Calls[fn] {
+		if g.Callee(call) == callee {
+			return call
+		}
+	}
+	return nil
+}
+
+//checkRecursion reports each cycle of calls at its first call, the one
+//that leaves the first func of the cycle
+func (p *Parser) checkRecursion(prog *Program) {
+
+	g := NewCallGraph(prog)
+	for _, c := range g.Cycles() {
+		call := g.call(c.Funcs[0], c.Funcs[1])
+		p.ErrGeneric("Recursive call to "+call.Name, call.Tok, "in cycle "+c.String())
+	}
+}
+
+//Errors returns a missing or repeated main, the cycles and the funcs
+//unreachable from main, in that order
+func (g *CallGraph) Errors() []error {
+
+	var errs []error
+	errAt := func(tok fxlex.Token, message string, place string) {
+		errs = append(errs, fmt.Errorf("%s: %s %s", tok.Start, message, place))
+	}
+
+	mains := g.Mains()
+	if len(mains) == 0 {
+		errs = append(errs, fmt.Errorf("%s: No function main", g.Prog.Tok.File))
+	}
+	for i := 1; i < len(mains); i++ {
+		errAt(mains[i].Tok, "Function main redeclared", "in program, previously declared at "+mains[0].Tok.Start.String())
+	}
+	for _, c := range g.Cycles() {
+		errAt(c.Call.Tok, "Recursive call to "+c.Call.Name, "in cycle "+c.String())
+	}
+	for _, fn := range g.Unreachable() {
+		errAt(fn.Tok, "Function "+fn.Name+" unreachable", "from main")
+	}
+	return errs
+}
+
+//WriteDot writes the graph in the Graphviz DOT language. The builtins
+//are boxes, the funcs unreachable from main are dashed and the calls
+//that close a cycle are red.
+func (g *CallGraph) WriteDot(w io.Writer) error {
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %q {\n", g.Prog.Tok.File)
+
+	unreached := map[*FuncDecl]bool{}
+	for _, fn := range g.Unreachable() {
+		unreached[fn] = true
+	}
+	builtins := []string{}
+	for _, fn := range g.Prog.Funcs {
+		if g.funcs[fn.Name] != fn {
+			continue
+		}
+		if unreached[fn] {
+			fmt.Fprintf(bw, "\t%q [style=dashed];\n", fn.Name)
+		} else {
+			fmt.Fprintf(bw, "\t%q;\n", fn.Name)
+		}
+		for _, b := range g.builtins[fn] {
+			if !contains(builtins, b) {
+				builtins = append(builtins, b)
+			}
+		}
+	}
+	for _, b := range builtins {
+		fmt.Fprintf(bw, "\t%q [shape=box];\n", b)
+	}
+
+	closing := map[[2]*FuncDecl]bool{}
+	for _, c := range g.Cycles() {
+		closing[[2]*FuncDecl{c.Funcs[len(c.Funcs)-2], c.Funcs[len(c.Funcs)-1]}] = true
+	}
+	for _, fn := range g.Prog.Funcs {
+		if g.funcs[fn.Name] != fn {
+			continue
+		}
+		for _, callee := range g.Callees(fn) {
+			if closing[[2]*FuncDecl{fn, callee}] {
+				fmt.Fprintf(bw, "\t%q -> %q [color=red];\n", fn.Name, callee.Name)
+			} else {
+				fmt.Fprintf(bw, "\t%q -> %q;\n", fn.Name, callee.Name)
+			}
+		}
+		for _, b := range g.builtins[fn] {
+			fmt.Fprintf(bw, "\t%q -> %q;\n", fn.Name, b)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
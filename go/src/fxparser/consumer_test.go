@@ -18,7 +18,7 @@ func TestConsumer(t *testing.T) {
 	reader := bufio.NewReader(fake_reader)
 	var myLexer *Lexer = NewLexer(reader, "consumer_test.txt", true) //true indicates if debug is activated
 	var myParser *Parser = NewParser(myLexer)
-	parseerror := myParser.ConsumeUntilMarker("{}();")
+	parseerror := myParser.ConsumeUntilMarker("{}();", false)
 	if parseerror != nil {
 		t.Error(parseerror)
 	}
@@ -34,9 +34,9 @@ func TestErrExpected(t *testing.T) {
 	var myLexer *Lexer = NewLexer(reader, "consumer_test.txt", true) //true indicates if debug is activated
 	var myParser *Parser = NewParser(myLexer)
 
-	parseerror := myParser.Parse()
-	if parseerror != nil {
-		t.Error(parseerror)
+	_, parseerror := myParser.Parse()
+	if parseerror == nil {
+		t.Error("syntax errors not detected")
 	}
 
 }
@@ -50,9 +50,9 @@ func TestErrExpected2(t *testing.T) {
 	var myLexer *Lexer = NewLexer(reader, "consumer_test.txt", true) //true indicates if debug is activated
 	var myParser *Parser = NewParser(myLexer)
 
-	parseerror := myParser.Parse()
-	if parseerror != nil {
-		t.Error(parseerror)
+	_, parseerror := myParser.Parse()
+	if parseerror == nil {
+		t.Error("syntax errors not detected")
 	}
 
 }
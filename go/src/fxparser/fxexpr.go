@@ -0,0 +1,193 @@
+package fxparser
+
+import (
+	"fmt"
+	"fxlex"
+)
+
+/*
+ *	Expressions are parsed with a Pratt parser (top down operator precedence)
+ *	https://web.archive.org/web/20151223215421/http://hall.org.ua/halls/wizzard/pdf/Vaughan.Pratt.TDOP.pdf
+ *
+ *	Precedence is like in C, from lower to higher:
+ *		|
+ *		^
+ *		&
+ *		==
+ *		< <= > >=
+ *		+ -
+ *		* / %
+ *		** and the unary operators ! - +
+ *
+ *	The field selector . binds tighter than any operator, -v.x is -(v.x)
+ *
+ *	** has the same precedence as the unary operators (like sizeof in C)
+ *	and it is right associative: -a ** b is -(a ** b) and a ** b ** c is
+ *	a ** (b ** c)
+ */
+
+const (
+	defRbp   = 0
+	unaryRbp = 80
+	selRbp   = 90
+)
+
+var precTab = map[fxlex.TokType]int{
+	fxlex.TokType('|'): 10,
+	fxlex.TokType('^'): 20,
+	fxlex.TokType('&'): 30,
+	fxlex.TokEqual:     40,
+	fxlex.TokType('<'): 50,
+	fxlex.TokType('>'): 50,
+	fxlex.TokSmaller:   50,
+	fxlex.TokGreater:   50,
+	fxlex.TokType('+'): 60,
+	fxlex.TokType('-'): 60,
+	fxlex.TokType('*'): 70,
+	fxlex.TokType('/'): 70,
+	fxlex.TokType('%'): 70,
+	fxlex.TokDMul:      unaryRbp,
+	fxlex.TokType('.'): selRbp,
+}
+
+//right associative operators
+var rightTab = map[fxlex.TokType]bool{
+	fxlex.TokDMul: true,
+}
+
+var unaryTab = map[fxlex.TokType]bool{
+	fxlex.TokType('!'): true,
+	fxlex.TokType('-'): true,
+	fxlex.TokType('+'): true,
+}
+
+func bindPow(tok fxlex.Token) int {
+	if rbp, ok := precTab[tok.Type]; ok {
+		return rbp
+	}
+	return defRbp
+}
+
+//no left context, null-denotation: nud
+func (p *Parser) Nud(tok fxlex.Token) (Expr, error) {
+	p.pushTrace("NUD")
+	defer p.popTrace()
+
+	if tok.Type == fxlex.TokType('(') {
+		//special unary, parenthesis
+		p.lex() //already peeked
+		expr, err := p.pratt(defRbp)
+		if err != nil {
+			return nil, err
+		}
+		tok_rpar, err, isRpar := p.match(fxlex.TokType(')'))
+		if err != nil || !isRpar {
+			err = p.ErrExpected("expression", tok_rpar, ")")
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	if tok.Type == fxlex.TokType('[') {
+		//Coord literal
+		p.lex() //already peeked
+		lit := &CoordLit{Tok: tok}
+		var err error
+		if lit.X, err = p.pratt(defRbp); err != nil {
+			return nil, err
+		}
+		tok_comma, err, isComma := p.match(fxlex.TokType(','))
+		if err != nil || !isComma {
+			err = p.ErrExpected("Coord literal", tok_comma, ",")
+			return nil, err
+		}
+		if lit.Y, err = p.pratt(defRbp); err != nil {
+			return nil, err
+		}
+		tok_rbra, err, isRbra := p.match(fxlex.TokType(']'))
+		if err != nil || !isRbra {
+			err = p.ErrExpected("Coord literal", tok_rbra, "]")
+			return nil, err
+		}
+		return lit, nil
+	}
+
+	if unaryTab[tok.Type] {
+		p.lex() //already peeked
+		//unary operators group right to left, -a ** b is -(a ** b)
+		x, err := p.pratt(unaryRbp - 1)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Tok: tok, Op: tok.Type, X: x}, nil
+	}
+
+	return p.Atom()
+}
+
+//left context, left-denotation: led
+func (p *Parser) Led(left Expr, tok fxlex.Token) (Expr, error) {
+	p.pushTrace("LED")
+	defer p.popTrace()
+
+	if tok.Type == fxlex.TokType('.') {
+		//postfix, the right side is always a field id
+		tok_id, err, isId := p.match(fxlex.TokId)
+		if err != nil || !isId {
+			err = p.ErrExpected("field selector", tok_id, "field id")
+			return nil, err
+		}
+		return &SelectorExpr{Tok: tok, X: left, Sel: &Ident{Tok: tok_id, Name: tok_id.Lexema}}, nil
+	}
+
+	rbp := bindPow(tok)
+	if rightTab[tok.Type] {
+		rbp -= 1
+	}
+	right, err := p.pratt(rbp)
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Tok: tok, Op: tok.Type, X: left, Y: right}, nil
+}
+
+func (p *Parser) pratt(rbp int) (Expr, error) {
+
+	p.pushTrace(fmt.Sprintf("PRATT %d", rbp))
+	defer p.popTrace()
+
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	left, err := p.Nud(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, err = p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if bindPow(tok) <= rbp {
+			return left, nil
+		}
+		p.lex() //already peeked
+		if left, err = p.Led(left, tok); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Parser) Expr() (Expr, error) {
+	//<EXPR> ::= <EXPR> binop <EXPR> |
+	//          unop <EXPR> |
+	//          <EXPR> '.' id |
+	//          '(' <EXPR> ')' |
+	//          <ATOM>
+	p.pushTrace("EXPR")
+	defer p.popTrace()
+
+	return p.pratt(defRbp)
+}
@@ -0,0 +1,88 @@
+package fxparser_test
+
+import (
+	"bufio"
+	"fmt"
+	. "fxlex"
+	. "fxparser"
+	"strings"
+	"testing"
+)
+
+//sexpr prints the expression fully parenthesized
+func sexpr(e Expr) string {
+
+	switch e := e.(type) {
+	case *Ident:
+		return e.Name
+	case *IntLit:
+		return fmt.Sprint(e.Value)
+	case *BoolLit:
+		return fmt.Sprint(e.Value)
+	case *UnaryExpr:
+		return fmt.Sprintf("(%s %s)", e.Tok.Lexema, sexpr(e.X))
+	case *BinaryExpr:
+		return fmt.Sprintf("(%s %s %s)", e.Tok.Lexema, sexpr(e.X), sexpr(e.Y))
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+type exprExamp struct {
+	input string
+	isBad bool
+	tree  string
+}
+
+var exprProgs = []exprExamp{
+	{"a * i", false, "(* a i)"},
+	{"1 + 2 * 3", false, "(+ 1 (* 2 3))"},
+	{"(1 + 2) * 3", false, "(* (+ 1 2) 3)"},
+	{"1 - 2 - 3", false, "(- (- 1 2) 3)"},
+	{"x > 3 | True", false, "(| (> x 3) true)"},
+	{"!b", false, "(! b)"},
+	{"!b & c ^ d | e", false, "(| (^ (& (! b) c) d) e)"},
+	{"a == b < c", false, "(== a (< b c))"},
+	{"a <= b", false, "(<= a b)"},
+	{"a >= b + 1", false, "(>= a (+ b 1))"},
+	{"a % 2 == 0", false, "(== (% a 2) 0)"},
+	{"2 ** 3 ** 2", false, "(** 2 (** 3 2))"},
+	{"2 * 3 ** 2", false, "(* 2 (** 3 2))"},
+	{"-2 ** 2", false, "(- (** 2 2))"},
+	{"2 ** -2", false, "(** 2 (- 2))"},
+	{"--(a)", false, "(- (- a))"},
+	{"a / +b", false, "(/ a (+ b))"},
+	//bad expr
+	{"", true, ""},
+	{"*3", true, ""},
+	{"3 *", true, ""},
+	{"(3 + 4", true, ""},
+	{"()", true, ""},
+}
+
+func TestExpr(t *testing.T) {
+
+	for _, v := range exprProgs {
+		reader := bufio.NewReader(strings.NewReader(v.input))
+		var myLexer *Lexer = NewLexer(reader, "expr_test.fx", true)
+		var myParser *Parser = NewParser(myLexer)
+		myParser.DebugDesc = false
+
+		expr, err := myParser.Expr()
+		if v.isBad {
+			if err == nil {
+				t.Errorf("%q should fail, parsed as %s", v.input, sexpr(expr))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", v.input, err)
+			continue
+		}
+		if tok, _ := myLexer.Peek(); tok.Type != TokEof {
+			t.Errorf("%q: expression ends at %s", v.input, tok.Lexema)
+		}
+		if s := sexpr(expr); s != v.tree {
+			t.Errorf("%q is %s, should be %s", v.input, s, v.tree)
+		}
+	}
+}
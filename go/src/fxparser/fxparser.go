@@ -1,9 +1,9 @@
 package fxparser
 
 import (
-	"errors"
 	"fmt"
 	"fxlex"
+	"io"
 	"os"
 	"strings"
 )
@@ -14,12 +14,19 @@ type Parser struct {
 	DebugDesc   bool
 	ErrorNumber int
 	Errors      []error
+	//Diag is where the errors are printed as they are found, nil keeps
+	//the parser quiet. Parse returns them anyway.
+	Diag io.Writer
+	//iter variables whose loop is over in the function being resolved
+	deadIters map[string]bool
+	//last lexer error, the lexer returns it on Peek and on Lex
+	lexErr error
 }
 
 func NewParser(l *fxlex.Lexer) *Parser {
 
 	var erarray []error
-	return &Parser{l, 0, true, 0, erarray}
+	return &Parser{l: l, DebugDesc: true, Errors: erarray}
 }
 
 func (p *Parser) pushTrace(tag string) {
@@ -35,24 +42,69 @@ func (p *Parser) popTrace() {
 	p.depth--
 }
 
+//peek and lex return the next token like the lexer does. The lexer
+//errors are recorded once with the syntax errors and the TokBad tokens
+//are skipped, so parsing goes on as if the bad text was not there.
+func (p *Parser) peek() (fxlex.Token, error) {
+
+	for {
+		t, err := p.l.Peek()
+		if err != nil && err != p.lexErr {
+			p.lexErr = err
+			p.errLexer(err)
+		}
+		if t.Type != fxlex.TokBad {
+			return t, nil
+		}
+		p.l.Lex()
+	}
+}
+
+func (p *Parser) lex() (fxlex.Token, error) {
+
+	p.peek()
+	t, _ := p.l.Lex()
+	return t, nil
+}
+
+//diag prints to Diag, if any
+func (p *Parser) diag(a ...interface{}) {
+
+	if p.Diag != nil {
+		fmt.Fprintln(p.Diag, a...)
+	}
+}
+
+func (p *Parser) errLexer(err error) {
+
+	p.diag(err)
+
+	if p.ErrorNumber >= 5 {
+		panic("Too many syntax errors")
+	}
+
+	p.ErrorNumber += 1
+	p.Errors = append(p.Errors, err)
+}
+
 func (p *Parser) match(tT fxlex.TokType) (t fxlex.Token, e error, isMatch bool) {
 
-	t, err := p.l.Peek()
+	t, err := p.peek()
 	if err != nil {
 		return fxlex.Token{}, err, false
 	}
 	if t.Type != tT {
 		return t, nil, false
 	}
-	t, err = p.l.Lex()
+	t, err = p.lex()
 	return t, nil, true
 
 }
 
 func (p *Parser) ErrExpected(place string, found fxlex.Token, wanted string) error {
 
-	err := fmt.Errorf("%s:%d: Expected %s in %s, found %s", found.File, found.Line, wanted, place, found.Lexema)
-	fmt.Println(err)
+	err := fmt.Errorf("%s: Expected %s in %s, found %s", found.Start, wanted, place, found.Lexema)
+	p.diag(err)
 
 	if p.ErrorNumber >= 5 {
 		panic("Too many syntax errors")
@@ -66,11 +118,12 @@ func (p *Parser) ErrExpected(place string, found fxlex.Token, wanted string) err
 	return err
 }
 
-func (p *Parser) ErrGeneric(message string, file string, line int, place string) error {
+//ErrGeneric records an error at the start of tok, file:line:col
+func (p *Parser) ErrGeneric(message string, tok fxlex.Token, place string) error {
 
-	err := fmt.Errorf("%s:%d: %s %s", file, line, message, place)
+	err := fmt.Errorf("%s: %s %s", tok.Start, message, place)
 
-	fmt.Println(err)
+	p.diag(err)
 
 	if p.ErrorNumber >= 5 {
 		panic("Too many syntax errors")
@@ -89,16 +142,16 @@ func (p *Parser) ErrGeneric(message string, file string, line int, place string)
 
 func (p *Parser) ConsumeUntilMarker(markers string, consume bool) error {
 
-	for t, _ := p.l.Peek(); ; t, _ = p.l.Peek() {
+	for t, _ := p.peek(); ; t, _ = p.peek() {
 		//t.PrintToken()
 		if t.Type != fxlex.TokEof {
 			if strings.Contains(markers, t.Lexema) {
 				if consume{
-					_, _ = p.l.Lex()
+					_, _ = p.lex()
 				}
 				return nil
 			} else {
-				_, err := p.l.Lex()
+				_, err := p.lex()
 				if err != nil {
 					return err
 				}
@@ -108,20 +161,18 @@ func (p *Parser) ConsumeUntilMarker(markers string, consume bool) error {
 			//os.Exit(1)
 		}
 	}
-
-	return nil
 }
 
 func (p *Parser) ConsumeUntilToken(token_type fxlex.TokType) error {
 
-	for t, _ := p.l.Peek(); ; t, _ = p.l.Peek() {
+	for t, _ := p.peek(); ; t, _ = p.peek() {
 
 		if t.Type != fxlex.TokEof {
 			if t.Type == token_type {
-				//_, _ = p.l.Lex()
+				//_, _ = p.lex()
 				return nil
 			} else {
-				_, err := p.l.Lex()
+				_, err := p.lex()
 				if err != nil {
 					return err
 				}
@@ -132,52 +183,55 @@ func (p *Parser) ConsumeUntilToken(token_type fxlex.TokType) error {
 		}
 	}
 
-	return nil
-
 }
 
-func (p *Parser) Exprend() error {
+func (p *Parser) Exprend() ([]Expr, error) {
 	//<EXPREND> ::= ',' <FARGS> | <EMPTY>
 
 	p.pushTrace("EXPREND")
 	defer p.popTrace()
-	t, err := p.l.Peek()
+	t, err := p.peek()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if t.Type == fxlex.TokType(',') {
 		//Es la primera regla
-		t, err = p.l.Lex()
+		t, err = p.lex()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		return p.Fargs()
 	}
 
 	//es la segunda regla
-	return nil
+	return nil, nil
 }
 
-func (p *Parser) Fargs() error {
+func (p *Parser) Fargs() ([]Expr, error) {
 	//<FARGS> ::= <EXPR> <EXPREND>
 	p.pushTrace("FARGS")
 	defer p.popTrace()
-	if err := p.Expr(); err != nil {
+	var args []Expr
+	expr, err := p.Expr()
+	if err != nil {
 		//fmt.Println("CONSUMED UNTIL MARKER")
 		p.ConsumeUntilMarker(",", false)
 		//return nil
 		//return err
+	} else {
+		args = append(args, expr)
 	}
 
-	if err := p.Exprend(); err != nil {
-		return err
+	rest, err := p.Exprend()
+	if err != nil {
+		return args, err
 	}
 
-	return nil
+	return append(args, rest...), nil
 }
 
-func (p *Parser) Rfuncall() error {
+func (p *Parser) Rfuncall() ([]Expr, error) {
 	//<RFUNCALL> := <FARGS> ')' ';' | ')' ';'
 	p.pushTrace("RFUNCALL")
 	defer p.popTrace()
@@ -185,7 +239,7 @@ func (p *Parser) Rfuncall() error {
 	//fmt.Println(tok)
 	if err != nil {
 		err = p.ErrExpected("on function call", tok, ")")
-		return err
+		return nil, err
 	}
 
 	if isRpar {
@@ -195,39 +249,39 @@ func (p *Parser) Rfuncall() error {
 		if err != nil || !isSemic {
 			//err = errors.New("Missing ';' token on function call")
 			err = p.ErrExpected("on function call", tok, ";")
-			return err
+			return nil, err
 		}
-		return nil
+		return nil, nil
 	}
 
-	err = p.Fargs()
+	args, err := p.Fargs()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	tok, err, isRpar = p.match(fxlex.TokType(')'))
 	//fmt.Println(tok)
 	if err != nil || !isRpar {
 		//err = errors.New("Missing ')' token on function call")
-		//err := p.ErrGeneric("Missing ')' token", tok.File, tok.Line, "on function call")
+		//err := p.ErrGeneric("Missing ')' token", tok, "on function call")
 		//return err
 		err = p.ErrExpected("on function call", tok, ")")
 		//p.ConsumeUntilMarker(";")
-		return err
+		return nil, err
 	}
 
 	tok, err, isSemic := p.match(fxlex.TokType(';'))
 	if err != nil || !isSemic {
 		//err = errors.New("Missing ';' token on function call")
 		err = p.ErrExpected("on function call", tok, ";")
-		//err = p.ErrGeneric("Missing ';' token", tok.File, tok.Line, "on function call")
-		return err
+		//err = p.ErrGeneric("Missing ';' token", tok, "on function call")
+		return nil, err
 	}
 
-	return nil
+	return args, nil
 }
 
-func (p *Parser) Funcall() error {
+func (p *Parser) Funcall(id fxlex.Token) (*CallStmt, error) {
 	//<FUNCALL> ::= '(' <RFUNCALL>
 
 	p.pushTrace("FUNCALL")
@@ -236,57 +290,53 @@ func (p *Parser) Funcall() error {
 	if err != nil || !isLpar {
 		//err = errors.New("Missing '(' on function call")
 		//return err
-	 	err = p.ErrExpected("function call", tok_1, "(")
+		err = p.ErrExpected("function call", tok_1, "(")
 		//p.ConsumeUntilMarker(")")
-		return err
+		return nil, err
 
 	}
 
-	err = p.Rfuncall()
-	if err != nil{
+	args, err := p.Rfuncall()
+	if err != nil {
 
 		//p.ConsumeUntilMarker(";")
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &CallStmt{Tok: id, Name: id.Lexema, Args: args}, nil
 }
 
-func (p *Parser) Atom() error {
+func (p *Parser) Atom() (Expr, error) {
 	//<ATOM> ::= id | intval | boolVal
 	p.pushTrace("ATOM")
 	defer p.popTrace()
-	t, err := p.l.Peek()
+	t, err := p.peek()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if ((t.Type == fxlex.TokId) || (t.Type == fxlex.TokValInt) || (t.Type == fxlex.TokValBool)) != false {
-		_, err = p.l.Lex()
+		t, err = p.lex()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		switch t.Type {
+		case fxlex.TokId:
+			return &Ident{Tok: t, Name: t.Lexema}, nil
+		case fxlex.TokValInt:
+			return &IntLit{Tok: t, Value: t.TokValInt}, nil
+		default:
+			return &BoolLit{Tok: t, Value: t.TokValBool}, nil
 		}
-		return nil
 	}
 	//err = errors.New("Bad atom")
-	err = p.ErrGeneric("Bad atom", t.File, t.Line, "")
-
-	return err
-}
+	err = p.ErrGeneric("Bad atom", t, "")
 
-func (p *Parser) Expr() error {
-	//TODO
-	//<EXPR> :: = <ATOM>
-	p.pushTrace("EXPR")
-	defer p.popTrace()
-	err := p.Atom()
-	if err != nil {
-		return err
-	}
-	return nil
+	return nil, err
 }
 
-func (p *Parser) Iter() error {
-	//<ITER> ::= 'iter' '(' id ':=' <EXPR> ';' <EXPR> ',' <EXPR> ')' '{' <BODY> '}'
+func (p *Parser) Iter() (*IterStmt, error) {
+	//<ITER> ::= 'iter' '(' id ':=' <EXPR> <ITERSEP> <EXPR> ',' <EXPR> ')' '{' <BODY> '}'
+	//<ITERSEP> ::= ';' | ','
 	p.pushTrace("ITER")
 	defer p.popTrace()
 
@@ -297,28 +347,31 @@ func (p *Parser) Iter() error {
 		//err = errors.New("Missing 'iter' on iter definition")
 		//return err
 		//err= p.ErrExpected("iter declaration", tok_1, "Iter")
-		err = p.ErrGeneric("Bad function call or empty", tok_1.File, tok_1.Line, "on function body")
-		return err
+		err = p.ErrGeneric("Bad function call or empty", tok_1, "on function body")
+		return nil, err
 	}
+	iter := &IterStmt{Tok: tok_1}
 
 	tok_2, err, isLpar := p.match(fxlex.TokType('('))
 	if err != nil || !isLpar {
 		//err = errors.New("Missing '(' token on iter definition")
 		//return err
-		err= p.ErrExpected("iter declaration", tok_2, "(")
+		err = p.ErrExpected("iter declaration", tok_2, "(")
 		p.ConsumeUntilMarker(":=", false)
 		has_error = true
 
 	}
 
-	if !has_error{
+	if !has_error {
 		has_error = false
 		tok, err, isId := p.match(fxlex.TokId)
 		if err != nil || !isId {
 			//err = errors.New("Missing id on iter definition")
-			err = p.ErrGeneric("Missing id", tok.File, tok.Line, "on iter definiton")
+			err = p.ErrGeneric("Missing id", tok, "on iter definiton")
 			p.ConsumeUntilMarker(":=", false)
 			has_error = true
+		} else {
+			iter.Var = &Ident{Tok: tok, Name: tok.Lexema}
 		}
 	}
 
@@ -326,14 +379,14 @@ func (p *Parser) Iter() error {
 	tok, err, isDDEq := p.match(fxlex.TokDDEq)
 	if err != nil || !isDDEq {
 		//err = errors.New("Missing ':=' token on iter definition")
-		err = p.ErrGeneric("Missing ':=' token", tok.File, tok.Line, "on iter definition")
+		err = p.ErrGeneric("Missing ':=' token", tok, "on iter definition")
 		p.ConsumeUntilMarker(";", false)
 		has_error = true
 	}
 
-	if !has_error{
+	if !has_error {
 		has_error = false
-		err = p.Expr()
+		iter.Start, err = p.Expr()
 		if err != nil {
 			p.ConsumeUntilMarker(";", false)
 			has_error = true
@@ -341,34 +394,38 @@ func (p *Parser) Iter() error {
 	}
 
 	//_, err, isSemic := p.match(fxlex.TokType(';'))
+	//the initial value can be followed by ';' or ','
 	has_error = false
 	tok, err, isSemic := p.match(fxlex.TokType(';'))
+	if err == nil && !isSemic {
+		tok, err, isSemic = p.match(fxlex.TokType(','))
+	}
 	if err != nil || !isSemic {
 
 		//err = errors.New("Missing ';' token on iter definition")
 		//return err
-		err = p.ErrGeneric("Missing ';' token", tok.File, tok.Line, "on iter definiton")
+		err = p.ErrGeneric("Missing ';' token", tok, "on iter definiton")
 		p.ConsumeUntilMarker(")", false)
 		has_error = true
 	}
 
-	if !has_error{
+	if !has_error {
 		has_error = false
-		err = p.Expr()
+		iter.End, err = p.Expr()
 		if err != nil {
 			//p.ConsumeUntilMarker("{}();")
-			return nil
+			return nil, nil
 		}
 
 		tok, err, isComma := p.match(fxlex.TokType(','))
 		if err != nil || !isComma {
 			//err = errors.New("Missing ',' token on iter definition")
-			err = p.ErrGeneric("Missing ',' token", tok.File, tok.Line, "on iter definition")
+			err = p.ErrGeneric("Missing ',' token", tok, "on iter definition")
 			p.ConsumeUntilMarker(")", false)
 		}
 
-		if !has_error{
-			err = p.Expr()
+		if !has_error {
+			iter.Step, err = p.Expr()
 			if err != nil {
 				p.ConsumeUntilMarker(")", false)
 			}
@@ -379,7 +436,7 @@ func (p *Parser) Iter() error {
 	tok, err, isRpar := p.match(fxlex.TokType(')'))
 	if err != nil || !isRpar {
 		//err = errors.New("Missing ')' token on iter definition")
-		err = p.ErrGeneric("Missing ')' token", tok.File, tok.Line, "on iter definition")
+		err = p.ErrGeneric("Missing ')' token", tok, "on iter definition")
 		p.ConsumeUntilMarker("{", false)
 		has_error = true
 	}
@@ -389,10 +446,11 @@ func (p *Parser) Iter() error {
 
 	if err != nil || !isLbra {
 		//err = errors.New("Missing '{' token on iter definition")
-		err = p.ErrGeneric("Missing '{' token", tok.File, tok.Line, "on iter definition")
+		err = p.ErrGeneric("Missing '{' token", tok, "on iter definition")
 	}
 
-	err = p.Body()
+	iter.Body = &Block{Tok: tok}
+	iter.Body.Stmts, err = p.Body()
 	if err != nil {
 		p.ConsumeUntilMarker("}", false)
 		has_error = true
@@ -402,14 +460,14 @@ func (p *Parser) Iter() error {
 
 	if err != nil || !isRbra {
 		//err = errors.New("Missing '}' token on iter definition")
-		err = p.ErrGeneric("Missing '}' token", tok.File, tok.Line, "on iter definition")
-		return err
+		err = p.ErrGeneric("Missing '}' token", tok, "on iter definition")
+		return nil, err
 	}
 
-	return nil
+	return iter, nil
 }
 
-func (p *Parser) Stmnt() error {
+func (p *Parser) Stmnt() (Stmt, error) {
 	//<STMNT> ::= id <FUNCALL> |
 	//            <ITER>
 	//UPDATE P5: AÑADIR DECLARACIONES
@@ -418,191 +476,329 @@ func (p *Parser) Stmnt() error {
 	//						int id ";"         | done
 	//						bool id ";"        |
 	//            <ITER>               done
+	//            <IF>
+	//UPDATE: id <SELECTORS> "=" <EXPR> ";"
+	//        id id ";"
 
 	p.pushTrace("STMNT")
 	defer p.popTrace()
 
-	_, err, isId := p.match(fxlex.TokId)
+	tok_id, err, isId := p.match(fxlex.TokId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	next_token, _ := p.l.Peek()
+	next_token, _ := p.peek()
 	if isId {
 		//es la primera regla o la segunda
 		//return p.Funcall()
 
-		if next_token.Type == fxlex.TokType('('){
-			err = p.Funcall()
-			if err != nil{
+		if next_token.Type == fxlex.TokType('(') {
+			call, err := p.Funcall(tok_id)
+			if err != nil {
 				err = p.ConsumeUntilMarker(";", true)
-				if err != nil{
-					return err
+				if err != nil {
+					return nil, err
 				}
 
 			}
-		}else if next_token.Type == fxlex.TokType('='){
+			if call == nil {
+				return nil, nil
+			}
+			return call, nil
+		} else if next_token.Type == fxlex.TokType('=') || next_token.Type == fxlex.TokType('.') {
 			//es la segunda regla
-			fmt.Println("Second rule")
-			_, err, is_eq := p.match(fxlex.TokType('='))
-			if err != nil{
-				return err
+			target, err := p.Selectors(&Ident{Tok: tok_id, Name: tok_id.Lexema})
+			if err != nil {
+				p.ConsumeUntilMarker(";", true)
+				return nil, nil
 			}
 
-			if !is_eq{
-				panic("Something went wrong while parsing")
+			tok_eq, err, is_eq := p.match(fxlex.TokType('='))
+			if err != nil {
+				return nil, err
 			}
 
-			err = p.Expr()
+			if !is_eq {
+				err = p.ErrExpected("Asignation", tok_eq, "=")
+				p.ConsumeUntilMarker(";", true)
+				return nil, nil
+			}
 
-			if err != nil{
+			value, err := p.Expr()
+
+			if err != nil {
 				p.ConsumeUntilMarker(";", true)
-				return nil
+				return nil, nil
 			}
 
 			tok_semic, err, is_semic := p.match(fxlex.TokType(';'))
 
-			if err != nil{
-				return err
+			if err != nil {
+				return nil, err
 			}
 
-			if !is_semic{
+			if !is_semic {
 				err = p.ErrExpected("Asignation", tok_semic, ";")
-				return nil
+				return nil, nil
 			}
 
-			return nil
+			return &AssignStmt{Tok: tok_eq, Target: target, Value: value}, nil
 
-		}else{
-			err = p.ErrGeneric("Malformed asignation or declaration", next_token.File, next_token.Line, "")
+		} else if next_token.Type == fxlex.TokId {
+			//es la séptima regla, el tipo es Coord o un record y se
+			//comprueba al resolver el programa
+			return p.Declend(tok_id)
+		} else {
+			err = p.ErrGeneric("Malformed asignation or declaration", next_token, "")
 			p.ConsumeUntilMarker(";", true)
-			return nil
+			return nil, nil
 		}
 
-		return nil
+	} else if next_token.Type == fxlex.TokDefInt || next_token.Type == fxlex.TokDefBool {
+		//es la tercera o la cuarta regla
+		return p.Decl()
+	} else if next_token.Type == fxlex.TokIf {
+		//es la sexta regla
+		ifs, err := p.If()
+		if ifs == nil {
+			return nil, err
+		}
+		return ifs, err
+	}
+	//es la quinta regla
+	return p.Iter()
+}
 
-	}else if next_token.Type == fxlex.TokDefInt{
-		//es la tercera regla
-		fmt.Println("Third rule")
-		_, err, isInt := p.match(fxlex.TokDefInt)
+func (p *Parser) If() (*IfStmt, error) {
+	//<IF> ::= 'if' '(' <EXPR> ')' <BLOCK> <ELSE>
+	p.pushTrace("IF")
+	defer p.popTrace()
 
-		if err != nil || !isInt{
-			panic("Something went wrong while parsing")
-		}
+	has_error := false
 
-		tok_id, err, isId := p.match(fxlex.TokId)
+	tok_1, err, isIf := p.match(fxlex.TokIf)
+	if err != nil || !isIf {
+		err = p.ErrExpected("if statement", tok_1, "if")
+		return nil, err
+	}
+	ifs := &IfStmt{Tok: tok_1}
 
-		if err != nil{
-			panic("Something went wrong while parsing")
+	tok, err, isLpar := p.match(fxlex.TokType('('))
+	if err != nil || !isLpar {
+		err = p.ErrExpected("if statement", tok, "(")
+		p.ConsumeUntilMarker(")", false)
+		has_error = true
+	}
+
+	if !has_error {
+		ifs.Cond, err = p.Expr()
+		if err != nil {
+			p.ConsumeUntilMarker(")", false)
 		}
+	}
 
-		if !isId{
+	tok, err, isRpar := p.match(fxlex.TokType(')'))
+	if err != nil || !isRpar {
+		err = p.ErrExpected("if statement", tok, ")")
+		p.ConsumeUntilMarker("{", false)
+	}
 
-			err = p.ErrExpected("Declaration", tok_id, "Id")
-			p.ConsumeUntilMarker(";", true)
-			return nil
+	ifs.Then, err = p.Block("if statement")
+	if err != nil {
+		return nil, err
+	}
 
-		}
+	ifs.Else, err = p.Else()
+	if err != nil {
+		return nil, err
+	}
 
-		tok_semic, err, isSemic := p.match(fxlex.TokType(';'))
+	return ifs, nil
+}
 
-		if err != nil{
-			panic("Something went wrong while parsing")
-		}
+func (p *Parser) Else() (Stmt, error) {
+	//<ELSE> ::= 'else' <ELSEEND> | <EMPTY>
+	//<ELSEEND> ::= <IF> | <BLOCK>
+	p.pushTrace("ELSE")
+	defer p.popTrace()
 
-		if !isSemic{
+	_, err, isElse := p.match(fxlex.TokElse)
+	if err != nil {
+		return nil, err
+	}
+	if !isElse {
+		return nil, nil
+	}
 
-			err = p.ErrExpected("Declaration", tok_semic, ";")
-			return nil
+	next_token, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if next_token.Type == fxlex.TokIf {
+		ifs, err := p.If()
+		if ifs == nil {
+			return nil, err
 		}
+		return ifs, err
+	}
 
-		return nil
+	block, err := p.Block("else statement")
+	if block == nil {
+		return nil, err
+	}
+	return block, err
+}
 
-	}else if next_token.Type == fxlex.TokDefBool{
-		//es la cuarta regla
-		fmt.Println("Fourth rule")
+func (p *Parser) Block(place string) (*Block, error) {
+	//<BLOCK> ::= '{' <BODY> '}'
+	p.pushTrace("BLOCK")
+	defer p.popTrace()
 
-		_, err, isBool := p.match(fxlex.TokDefBool)
+	tok, err, isLbra := p.match(fxlex.TokType('{'))
+	if err != nil || !isLbra {
+		err = p.ErrExpected(place, tok, "{")
+	}
 
-		if err != nil || !isBool{
-			panic("Something went wrong while parsing")
-		}
+	block := &Block{Tok: tok}
+	block.Stmts, err = p.Body()
+	if err != nil {
+		p.ConsumeUntilMarker("}", false)
+	}
 
-		tok_id, err, isId := p.match(fxlex.TokId)
+	tok, err, isRbra := p.match(fxlex.TokType('}'))
+	if err != nil || !isRbra {
+		err = p.ErrExpected(place, tok, "}")
+		return nil, err
+	}
 
-		if err != nil{
-			panic("Something went wrong while parsing")
-		}
+	return block, nil
+}
 
-		if !isId{
-			err = p.ErrExpected("Declaration", tok_id, "id")
-			p.ConsumeUntilMarker(";", true)
-			return nil
+func (p *Parser) Selectors(x Expr) (Expr, error) {
+	//<SELECTORS> ::= '.' id <SELECTORS> | <EMPTY>
+	p.pushTrace("SELECTORS")
+	defer p.popTrace()
+
+	for {
+		tok_dot, err, isDot := p.match(fxlex.TokType('.'))
+		if err != nil {
+			return nil, err
 		}
+		if !isDot {
+			return x, nil
+		}
+		tok_id, err, isId := p.match(fxlex.TokId)
+		if err != nil || !isId {
+			err = p.ErrExpected("field selector", tok_id, "field id")
+			return nil, err
+		}
+		x = &SelectorExpr{Tok: tok_dot, X: x, Sel: &Ident{Tok: tok_id, Name: tok_id.Lexema}}
+	}
+}
 
-		tok_semic, err, isSemic := p.match(fxlex.TokType(';'))
+func (p *Parser) Decl() (*VarDecl, error) {
+	//<DECL> ::= int <DECLEND> | bool <DECLEND>
+	p.pushTrace("DECL")
+	defer p.popTrace()
 
-		if err != nil{
+	tok_type, err, isInt := p.match(fxlex.TokDefInt)
+	if err != nil {
+		panic("Something went wrong while parsing")
+	}
+	if !isInt {
+		var isBool bool
+		tok_type, err, isBool = p.match(fxlex.TokDefBool)
+		if err != nil || !isBool {
 			panic("Something went wrong while parsing")
 		}
+	}
 
-		if !isSemic{
-			
-			err = p.ErrExpected("Declaration", tok_semic, ";")
-			return nil
-		}
+	return p.Declend(tok_type)
+}
 
-		return nil
+func (p *Parser) Declend(tok_type fxlex.Token) (*VarDecl, error) {
+	//<DECLEND> ::= id ';'
+	p.pushTrace("DECLEND")
+	defer p.popTrace()
+
+	tok_id, err, isId := p.match(fxlex.TokId)
+
+	if err != nil {
+		panic("Something went wrong while parsing")
 	}
-	//es la segunda regla
-	return p.Iter()
+
+	if !isId {
+
+		err = p.ErrExpected("Declaration", tok_id, "Id")
+		p.ConsumeUntilMarker(";", true)
+		return nil, nil
+
+	}
+
+	tok_semic, err, isSemic := p.match(fxlex.TokType(';'))
+
+	if err != nil {
+		panic("Something went wrong while parsing")
+	}
+
+	if !isSemic {
+
+		err = p.ErrExpected("Declaration", tok_semic, ";")
+		return nil, nil
+	}
+
+	decl := &VarDecl{Tok: tok_id, Name: tok_id.Lexema, TypeTok: tok_type, TypeName: tok_type.Lexema}
+	return decl, nil
 }
 
-func (p *Parser) Stmntend() error {
+func (p *Parser) Stmntend() ([]Stmt, error) {
 	//<STMNTEND> ::= <BODY> |
 	//               <EMPTY>
 	p.pushTrace("STMNTEND")
 	defer p.popTrace()
 
-	t, err := p.l.Peek()
+	t, err := p.peek()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if t.Type == fxlex.TokType('}') {
 		//ha acabado el body, por lo tanto empty
-		return nil
-	} else {
-		//hay más sentencias
-		return p.Body()
+		return nil, nil
 	}
-
-	err = errors.New("Unkown or malformed statement")
-	return err
+	//hay más sentencias
+	return p.Body()
 
 }
 
-func (p *Parser) Body() error {
+func (p *Parser) Body() ([]Stmt, error) {
 
 	//<BODY> ::= <STMNT> <STMNTEND>
 
 	p.pushTrace("BODY")
 	defer p.popTrace()
 
-	if err := p.Stmnt(); err != nil {
-		return err
+	var stmts []Stmt
+	stmt, err := p.Stmnt()
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		stmts = append(stmts, stmt)
 	}
 
-	if err := p.Stmntend(); err != nil {
-		return err
+	rest, err := p.Stmntend()
+	if err != nil {
+		return stmts, err
 	}
 
-	return nil
+	return append(stmts, rest...), nil
 
 }
 
-func (p *Parser) Fdecargs() error {
-	//<FDECARGS> ::= ',' id id <FDECARGS> |
-	//               id id <FDECARGS> |
+func (p *Parser) Fdecargs() ([]*Param, error) {
+	//<FDECARGS> ::= ',' <TYPE> id <FDECARGS> |
+	//               <TYPE> id <FDECARGS> |
 	//               <EMPTY>
 
 	p.pushTrace("FDECARGS")
@@ -611,74 +807,91 @@ func (p *Parser) Fdecargs() error {
 	_, err, isComma := p.match(fxlex.TokType(','))
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if isComma {
 		//Es la primera regla
 		//comprobar todos los componentes de la primera regla
-		//comprobar el primer ID
-		_, err, isInt := p.match(fxlex.TokDefInt)
-		tok_2, err1, isBool := p.match(fxlex.TokDefBool)
-		if err != nil || err1 != nil || (isInt || isBool) == false {
+		//comprobar el tipo
+		tok_type, err, isType := p.matchType()
+		if err != nil || !isType {
 			//err = errors.New("Missing Id on function arguments")
 			//return err
-			err= p.ErrExpected("function arguments", tok_2, "Type")
+			err = p.ErrExpected("function arguments", tok_type, "Type")
 			p.ConsumeUntilMarker(")", false)
-			return nil
+			return nil, nil
 		}
-		//comprobar el segundo id
+		//comprobar el id
 		tok_1, err, isId := p.match(fxlex.TokId)
 		if err != nil || !isId {
 			//err = errors.New("Missing Id on function arguments")
 			//return err
-			err= p.ErrExpected("function declaration", tok_1, "Id")
+			err = p.ErrExpected("function declaration", tok_1, "Id")
 			p.ConsumeUntilMarker(")", false)
-			return nil
+			return nil, nil
 		}
 
-		return p.Fdecargs()
+		param := &Param{Tok: tok_1, Name: tok_1.Lexema, TypeTok: tok_type, TypeName: tok_type.Lexema}
+		rest, err := p.Fdecargs()
+		return append([]*Param{param}, rest...), err
 	}
 
 	//comprobar si es la segunda regla
-	_, err, isInt := p.match(fxlex.TokDefInt)
-	_, err1, isBool := p.match(fxlex.TokDefBool)
+	tok_type, err, isType := p.matchType()
 
-	if err != nil || err1 != nil {
+	if err != nil {
 
-		return err
+		return nil, err
 	}
 
-	if isInt || isBool {
+	if isType {
 		//Es la segunda regla
 		//Comprobar todos los componentes de la segunda regla
-		//comprobar el segundo id
+		//comprobar el id
 		tok_1, err, isId := p.match(fxlex.TokId)
 		if err != nil || !isId {
 			//err = errors.New("Missing Id on function arguments")
 			//return err
-			err= p.ErrExpected("function declaration", tok_1, "Id")
+			err = p.ErrExpected("function declaration", tok_1, "Id")
 			p.ConsumeUntilMarker(")", false)
-			return nil
+			return nil, nil
 		}
 
-		return p.Fdecargs()
+		param := &Param{Tok: tok_1, Name: tok_1.Lexema, TypeTok: tok_type, TypeName: tok_type.Lexema}
+		rest, err := p.Fdecargs()
+		return append([]*Param{param}, rest...), err
 	}
 	//es la tercera regla, con lo cual empty o bien hay algún error
-	t, err := p.l.Peek()
+	t, err := p.peek()
 
-	if t.Type == fxlex.TokType(')'){
-		return nil
+	if t.Type == fxlex.TokType(')') {
+		return nil, nil
 	}
 
 	tok, err, _ := p.match(fxlex.TokType(')'))
-	err= p.ErrExpected("function definition", tok, ")")
+	err = p.ErrExpected("function definition", tok, ")")
 	p.ConsumeUntilMarker(")", false)
-	return nil
+	return nil, nil
 
 }
 
-func (p *Parser) Finside() error {
+//matchType matches <TYPE> ::= int | bool | id
+func (p *Parser) matchType() (t fxlex.Token, e error, isMatch bool) {
+
+	t, err := p.peek()
+	if err != nil {
+		return fxlex.Token{}, err, false
+	}
+	switch t.Type {
+	case fxlex.TokDefInt, fxlex.TokDefBool, fxlex.TokId:
+		t, err = p.lex()
+		return t, err, true
+	}
+	return t, nil, false
+}
+
+func (p *Parser) Finside() ([]*Param, error) {
 	//<FINSIDE> :: = <FDECARGS> ')' |')'
 
 	p.pushTrace("FINSIDE")
@@ -687,31 +900,32 @@ func (p *Parser) Finside() error {
 	_, err, isRpar := p.match(fxlex.TokType(')'))
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if isRpar {
-		return nil
+		return nil, nil
 	}
 
-	if err := p.Fdecargs(); err != nil {
-		return err
+	params, err := p.Fdecargs()
+	if err != nil {
+		return nil, err
 	}
 
 	tok_1, err, isRpar := p.match(fxlex.TokType(')'))
 
 	if err != nil || !isRpar {
-		err= p.ErrExpected("function declaration", tok_1, ")")
+		err = p.ErrExpected("function declaration", tok_1, ")")
 		//err = errors.New("Missing ')' token on function definition")
 		//return err
-		return err
+		return params, err
 	}
 
-	return nil
+	return params, nil
 
 }
 
-func (p *Parser) Fsig() error {
+func (p *Parser) Fsig() (*FuncDecl, error) {
 	//<FSIG> :: = 'func' ID '(' <FINSIDE> |
 	//						'func' main '(' <FINSIDE> |
 
@@ -720,101 +934,111 @@ func (p *Parser) Fsig() error {
 	tok_1, err, isFunc := p.match(fxlex.TokFunc)
 
 	if err != nil || !isFunc {
-		err= p.ErrExpected("function declaration", tok_1, "func")
+		err = p.ErrExpected("function declaration", tok_1, "func")
 		//return err
-		return err
+		return nil, err
 	}
 
-	_, err, isId := p.match(fxlex.TokId)
-	_, err_main, isMain := p.match(fxlex.TokMain)
+	tok_id, err, isId := p.match(fxlex.TokId)
+	tok_main, err_main, isMain := p.match(fxlex.TokMain)
 
+	if err != nil || err_main != nil {
 
-	if err != nil || err_main != nil{
-
-		if err != nil{
+		if err != nil {
 			//err= p.ErrExpected("function declaration", tok_2, "id")
 			//return err
-			return err
-		}else if err_main != nil{
+			return nil, err
+		} else if err_main != nil {
 			//err= p.ErrExpected("function declaration", tok_main, "id")
 			//return err
-			return err
+			return nil, err
 		}
 	}
 
-	if isId || isMain{
+	if isId || isMain {
+
+		fn := &FuncDecl{Tok: tok_id, Name: tok_id.Lexema}
+		if isMain {
+			fn = &FuncDecl{Tok: tok_main, Name: tok_main.Lexema}
+		}
+		fn.Doc = tok_1.Doc
 
 		tok_3, err, isLpar := p.match(fxlex.TokType('('))
 
 		if err != nil || !isLpar {
-			err= p.ErrExpected("function declaration", tok_3, "(")
+			err = p.ErrExpected("function declaration", tok_3, "(")
 			//return err
-			return err
+			return nil, err
 		}
 
-		if err := p.Finside(); err != nil {
+		fn.Params, err = p.Finside()
+		if err != nil {
 			//return err
 			p.ConsumeUntilMarker("{", false)
-			return nil
+			return fn, nil
 		}
 
-	}else{
-		//even though the function is not correctly defined, keep the flow and evaluate everything to search for more
-		//errors
-		tok_err, _, _ := p.match(fxlex.TokType('('))
-		err= p.ErrExpected("function declaration", tok_err, "main or function id")
-		p.ConsumeUntilMarker("(", false)
+		return fn, nil
 
-		tok_3, err, isLpar := p.match(fxlex.TokType('('))
+	}
+	//even though the function is not correctly defined, keep the flow and evaluate everything to search for more
+	//errors
+	tok_err, _, _ := p.match(fxlex.TokType('('))
+	err = p.ErrExpected("function declaration", tok_err, "main or function id")
+	p.ConsumeUntilMarker("(", false)
 
-		if err != nil || !isLpar {
-			err= p.ErrExpected("function declaration", tok_3, "(")
-			//return err
-			return err
-		}
+	tok_3, err, isLpar := p.match(fxlex.TokType('('))
 
-		if err := p.Finside(); err != nil {
-			p.ConsumeUntilMarker("{", false)
-			return nil
-		}
+	if err != nil || !isLpar {
+		err = p.ErrExpected("function declaration", tok_3, "(")
+		//return err
+		return nil, err
+	}
 
+	fn := &FuncDecl{Tok: tok_err}
+	fn.Params, err = p.Finside()
+	if err != nil {
+		p.ConsumeUntilMarker("{", false)
 	}
 
-	return nil
+	return fn, nil
 }
 
-func (p *Parser) Func() error {
+func (p *Parser) Func() (*FuncDecl, error) {
 	//<FUNC> ::= <FSIG> '{' <BODY> '}'
 	p.pushTrace("FUNC")
 	defer p.popTrace()
 
-	if err := p.Fsig(); err != nil {
-		return err
+	fn, err := p.Fsig()
+	if err != nil {
+		return nil, err
 	}
 
 	tok_1, err, isLbra := p.match(fxlex.TokType('{'))
 
 	if err != nil || !isLbra {
-		err= p.ErrExpected("function", tok_1, "{")
+		err = p.ErrExpected("function", tok_1, "{")
 		//p.ConsumeUntilMarker("}")
 		//return err
-		return err
+		return nil, err
 	}
 
-	if err := p.Body(); err != nil {
-		return err
+	fn.Body = &Block{Tok: tok_1}
+	fn.Body.Stmts, err = p.Body()
+	if err != nil {
+		return nil, err
 	}
 
 	_, err, isRbra := p.match(fxlex.TokType('}'))
 	if err != nil || !isRbra {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return fn, nil
 
 }
 
-func (p *Parser) End() error {
+func (p *Parser) End(prog *Program) error {
 	//<END> ::= <PROG> | <EOF>
 	p.pushTrace("END")
 	defer p.popTrace()
@@ -829,11 +1053,12 @@ func (p *Parser) End() error {
 		return nil
 	}
 
-	return p.Prog()
+	return p.Prog(prog)
 }
 
-func (p *Parser) Prog() error {
-	//<PROG> ::= <FUNC> <END> | <EOF>
+func (p *Parser) Prog(prog *Program) error {
+	//<PROG> ::= <DECL> <END> | <EOF>
+	//<DECL> ::= <FUNC> | <RECORD>
 	p.pushTrace("PROG")
 	defer p.popTrace()
 	_, err, isEOF := p.match(fxlex.TokEof)
@@ -847,38 +1072,182 @@ func (p *Parser) Prog() error {
 		return nil
 	}
 
-	if err := p.Func(); err != nil {
+	next_token, err := p.peek()
+	if err != nil {
 		return err
-	} else {
-		return p.End()
 	}
+	if next_token.Type == fxlex.TokTypeDef {
+		rec, err := p.Record()
+		if err != nil {
+			return err
+		}
+		if rec != nil {
+			p.declRecord(prog, rec)
+		}
+		return p.End(prog)
+	}
+
+	fn, err := p.Func()
+	if err != nil {
+		return err
+	}
+	if fn != nil {
+		prog.Funcs = append(prog.Funcs, fn)
+	}
+	return p.End(prog)
 
 }
 
-func (p *Parser) Parse() []error {
+func (p *Parser) Record() (*RecordDecl, error) {
+	//<RECORD> ::= 'type' 'record' id '(' <FIELDS> ')'
+	p.pushTrace("RECORD")
+	defer p.popTrace()
+
+	tok, err, isType := p.match(fxlex.TokTypeDef)
+	if err != nil || !isType {
+		err = p.ErrExpected("type declaration", tok, "type")
+		return nil, err
+	}
+	doc := tok.Doc
+
+	tok, err, isRecord := p.match(fxlex.TokRecord)
+	if err != nil || !isRecord {
+		err = p.ErrExpected("type declaration", tok, "record")
+		p.ConsumeUntilMarker(")", true)
+		return nil, nil
+	}
+
+	tok_id, err, isId := p.match(fxlex.TokId)
+	if err != nil || !isId {
+		err = p.ErrExpected("record declaration", tok_id, "id")
+		p.ConsumeUntilMarker(")", true)
+		return nil, nil
+	}
+	rec := &RecordDecl{Tok: tok_id, Name: tok_id.Lexema, Doc: doc}
+
+	tok, err, isLpar := p.match(fxlex.TokType('('))
+	if err != nil || !isLpar {
+		err = p.ErrExpected("record declaration", tok, "(")
+		p.ConsumeUntilMarker(")", true)
+		return nil, nil
+	}
+
+	rec.Fields, err = p.Fields()
+	if err != nil {
+		p.ConsumeUntilMarker(")", true)
+		return nil, nil
+	}
+
+	tok, err, isRpar := p.match(fxlex.TokType(')'))
+	if err != nil || !isRpar {
+		err = p.ErrExpected("record declaration", tok, ")")
+		p.ConsumeUntilMarker(")", true)
+		return nil, nil
+	}
+
+	return rec, nil
+}
+
+func (p *Parser) Fields() ([]*Field, error) {
+	//<FIELDS> ::= <TYPE> id <FIELDSEND>
+	//<TYPE> ::= int | bool | id
+	p.pushTrace("FIELDS")
+	defer p.popTrace()
+
+	tok_type, err, isType := p.matchType()
+	if err != nil || !isType {
+		err = p.ErrExpected("record fields", tok_type, "Type")
+		return nil, err
+	}
+
+	tok_id, err, isId := p.match(fxlex.TokId)
+	if err != nil || !isId {
+		err = p.ErrExpected("record fields", tok_id, "Id")
+		return nil, err
+	}
+	field := &Field{Tok: tok_id, Name: tok_id.Lexema, TypeTok: tok_type, TypeName: tok_type.Lexema}
+
+	rest, err := p.Fieldsend()
+	return append([]*Field{field}, rest...), err
+}
+
+func (p *Parser) Fieldsend() ([]*Field, error) {
+	//<FIELDSEND> ::= ',' <FIELDS> | <EMPTY>
+	p.pushTrace("FIELDSEND")
+	defer p.popTrace()
+
+	_, err, isComma := p.match(fxlex.TokType(','))
+	if err != nil {
+		return nil, err
+	}
+	if isComma {
+		return p.Fields()
+	}
+	return nil, nil
+}
+
+//declRecord adds rec to the program. The types of the fields must be
+//builtin or already declared, so records cannot be recursive.
+func (p *Parser) declRecord(prog *Program, rec *RecordDecl) {
+
+	if prev := prog.Record(rec.Name); prev != nil {
+		p.ErrGeneric("Record "+rec.Name+" redeclared", rec.Tok, "in type declaration")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, f := range rec.Fields {
+		if seen[f.Name] {
+			p.ErrGeneric("Duplicate field "+f.Name, f.Tok, "in record "+rec.Name)
+		}
+		seen[f.Name] = true
+		if f.TypeTok.Type == fxlex.TokId && prog.Record(f.TypeName) == nil {
+			p.ErrGeneric("Unknown type "+f.TypeName, f.TypeTok, "in record "+rec.Name)
+		}
+	}
+
+	prog.Records = append(prog.Records, rec)
+}
+
+//Parse returns the tree of the program together with the syntax errors
+//found. On errors the tree only holds what could be recovered.
+func (p *Parser) Parse() (prog *Program, errs []error) {
 	p.pushTrace("Parse")
 	//defer p.popTrace()
-	defer func(){
+	defer func() {
 		p.popTrace()
-		if r := recover(); r != nil{
-			fmt.Println(p.Errors)
+		if r := recover(); r != nil {
+			p.diag(p.Errors)
+			if p.Errors == nil {
+				p.Errors = append(p.Errors, fmt.Errorf("%v", r))
+			}
+			errs = p.Errors
 		}
 	}()
 
-	p.Prog()
+	prog = &Program{Files: p.l.FileSet()}
+	prog.Tok, _ = p.peek()
+	p.Prog(prog)
 
+	if p.Errors == nil {
+		p.resolve(prog)
+		p.typecheck(prog)
+	}
+	if p.Errors == nil {
+		p.checkRecursion(prog)
+	}
 
-	if p.Errors != nil{
-		fmt.Println("SYNTAX ERROR")
-		return p.Errors
+	if p.Errors != nil {
+		p.diag("SYNTAX ERROR")
+		return prog, p.Errors
 	}
 
 	/*
-	if err := p.Prog(); err != nil {
-		fmt.Println("SYNTAX ERROR")
-		return err
-	}
+		if err := p.Prog(); err != nil {
+			fmt.Println("SYNTAX ERROR")
+			return err
+		}
 	*/
 
-	return nil
+	return prog, nil
 }
@@ -5,7 +5,10 @@ import (
 	"flag"
 	. "fxlex"
 	. "fxparser"
+	"fxsym"
+	"fxtest"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -13,7 +16,6 @@ var filename = flag.String("file", "", "file to read")
 
 func TestLexer(t *testing.T) {
 
-	t.Error("dummy error")
 	filename := *filename
 	file, err := os.Open(filename)
 	if err != nil {
@@ -24,9 +26,909 @@ func TestLexer(t *testing.T) {
 	reader := bufio.NewReader(file)
 	var myLexer *Lexer = NewLexer(reader, filename, true) //true indicates if debug is activated
 	var myParser *Parser = NewParser(myLexer)
-	parseerror := myParser.Parse()
+	_, parseerror := myParser.Parse()
 	if parseerror != nil {
 		t.Error(parseerror)
 	}
 
 }
+
+func parseString(t *testing.T, text string) (*Program, []error) {
+
+	reader := bufio.NewReader(strings.NewReader(text))
+	var myLexer *Lexer = NewLexer(reader, "tree_test.fx", true)
+	var myParser *Parser = NewParser(myLexer)
+	myParser.DebugDesc = false
+	return myParser.Parse()
+}
+
+func TestTree(t *testing.T) {
+
+	const text = "func line(int x, bool b){\n" +
+		"  int y;\n" +
+		"  y = 3;\n" +
+		"  iter (i := 0; x, 1){\n" +
+		"    circle([i, y], 5, 5);\n" +
+		"  }\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  line(2, True);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if len(prog.Funcs) != 2 {
+		t.Fatalf("expected 2 funcs, got %d", len(prog.Funcs))
+	}
+
+	line := prog.Func("line")
+	if line == nil || len(line.Params) != 2 {
+		t.Fatalf("bad func line: %+v", line)
+	}
+	if line.Params[1].Name != "b" || line.Params[1].TypeName != "bool" {
+		t.Errorf("bad param: %+v", line.Params[1])
+	}
+	if len(line.Body.Stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(line.Body.Stmts))
+	}
+
+	decl, ok := line.Body.Stmts[0].(*VarDecl)
+	if !ok || decl.Name != "y" || decl.TypeName != "int" || decl.Token().Line != 2 {
+		t.Errorf("bad declaration: %+v", line.Body.Stmts[0])
+	}
+	asig, ok := line.Body.Stmts[1].(*AssignStmt)
+	if !ok || asig.Target.(*Ident).Name != "y" || asig.Value.(*IntLit).Value != 3 {
+		t.Errorf("bad asignation: %+v", line.Body.Stmts[1])
+	}
+	iter, ok := line.Body.Stmts[2].(*IterStmt)
+	if !ok || iter.Var.Name != "i" || iter.End.(*Ident).Name != "x" || iter.Token().Line != 4 {
+		t.Fatalf("bad iter: %+v", line.Body.Stmts[2])
+	}
+	call, ok := iter.Body.Stmts[0].(*CallStmt)
+	if !ok || call.Name != "circle" || len(call.Args) != 3 || call.Token().Line != 5 {
+		t.Errorf("bad call: %+v", iter.Body.Stmts[0])
+	}
+
+	main := prog.Func("main")
+	call, ok = main.Body.Stmts[0].(*CallStmt)
+	if !ok || call.Args[1].(*BoolLit).Value != true {
+		t.Errorf("bad call: %+v", main.Body.Stmts[0])
+	}
+}
+
+func TestIf(t *testing.T) {
+
+	const text = "func main(int x, bool a, bool b){\n" +
+		"  if(x > 3 | True){\n" +
+		"    circle([1, 2], 3, 4);\n" +
+		"  }\n" +
+		"  if(b){\n" +
+		"    circle([1, 2], 3, 4);\n" +
+		"  } else {\n" +
+		"    rect([1, 2], 3, 4);\n" +
+		"    rect([1, 2], 3, 4);\n" +
+		"  }\n" +
+		"  if(a){\n" +
+		"    circle([1, 2], 3, 4);\n" +
+		"  } else if(b){\n" +
+		"    rect([1, 2], 3, 4);\n" +
+		"  } else {\n" +
+		"    line(1);\n" +
+		"  }\n" +
+		"}\n" +
+		"func line(int n){\n" +
+		"  circle([n, n], n, n);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	stmts := prog.Func("main").Body.Stmts
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(stmts))
+	}
+
+	ifs, ok := stmts[0].(*IfStmt)
+	if !ok || ifs.Else != nil || len(ifs.Then.Stmts) != 1 || ifs.Token().Line != 2 {
+		t.Errorf("bad if: %+v", stmts[0])
+	}
+	if _, ok := ifs.Cond.(*BinaryExpr); !ok {
+		t.Errorf("bad if condition: %+v", ifs.Cond)
+	}
+
+	ifs, ok = stmts[1].(*IfStmt)
+	if !ok {
+		t.Fatalf("bad if: %+v", stmts[1])
+	}
+	if els, ok := ifs.Else.(*Block); !ok || len(els.Stmts) != 2 {
+		t.Errorf("bad else: %+v", ifs.Else)
+	}
+
+	ifs, ok = stmts[2].(*IfStmt)
+	if !ok {
+		t.Fatalf("bad if: %+v", stmts[2])
+	}
+	elif, ok := ifs.Else.(*IfStmt)
+	if !ok || elif.Token().Line != 13 {
+		t.Fatalf("bad else if: %+v", ifs.Else)
+	}
+	if els, ok := elif.Else.(*Block); !ok || els.Stmts[0].(*CallStmt).Name != "line" {
+		t.Errorf("bad else: %+v", elif.Else)
+	}
+}
+
+func TestIfErrors(t *testing.T) {
+
+	//the errors are reported and parsing goes on after them
+	const text = "func main(){\n" +
+		"  if x > 3){\n" +
+		"    circle([1, 2], 3, 4);\n" +
+		"  }\n" +
+		"  if(x > 3 {\n" +
+		"    circle([1, 2], 3, 4);\n" +
+		"  } else {\n" +
+		"    rect([1, 2], 3, 4);\n" +
+		"  }\n" +
+		"  circle([1, 2], 3, 4);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "tree_test.fx:2:") {
+		t.Errorf("bad error position: %s", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), "tree_test.fx:5:") {
+		t.Errorf("bad error position: %s", errs[1])
+	}
+	stmts := prog.Func("main").Body.Stmts
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(stmts))
+	}
+	if _, ok := stmts[1].(*IfStmt).Else.(*Block); !ok {
+		t.Errorf("else lost after error")
+	}
+}
+
+func TestRecord(t *testing.T) {
+
+	const text = "type record vector(int x, int y, int z)\n" +
+		"type record difficult (vector v, Coord r, bool b)\n" +
+		"func main(){\n" +
+		"  circle([1, 2], 3, 4);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if len(prog.Records) != 2 || len(prog.Funcs) != 1 {
+		t.Fatalf("expected 2 records and 1 func, got %d and %d", len(prog.Records), len(prog.Funcs))
+	}
+	vector := prog.Record("vector")
+	if vector == nil || len(vector.Fields) != 3 || vector.Field("z").TypeName != "int" {
+		t.Errorf("bad record vector: %+v", vector)
+	}
+	difficult := prog.Record("difficult")
+	if difficult == nil || difficult.Token().Line != 2 {
+		t.Fatalf("bad record difficult: %+v", difficult)
+	}
+	if f := difficult.Field("v"); f == nil || f.TypeName != "vector" {
+		t.Errorf("bad field v: %+v", f)
+	}
+	if f := difficult.Field("r"); f == nil || prog.Record(f.TypeName) != CoordDecl {
+		t.Errorf("bad field r: %+v", f)
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+
+	const text = "type record later(vector v)\n" +
+		"type record vector(int x, int y, int x)\n" +
+		"type record vector(int x)\n" +
+		"type record self(self s)\n" +
+		"type record (int x)\n" +
+		"type record ok(Coord c)\n"
+
+	prog, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:1:19: Unknown type vector",
+		"tree_test.fx:2:38: Duplicate field x",
+		"tree_test.fx:3:13: Record vector redeclared",
+		"tree_test.fx:4:18: Unknown type self",
+		"tree_test.fx:5:13: Expected id in record declaration",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if !strings.HasPrefix(errs[i].Error(), w) {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+	if prog.Record("ok") == nil {
+		t.Errorf("record after errors lost")
+	}
+}
+
+func TestSelector(t *testing.T) {
+
+	const text = "type record vector(int x, int y, int z)\n" +
+		"type record difficult(vector v, Coord r)\n" +
+		"func main(difficult d, vector a, int i, Coord c, Coord p){\n" +
+		"  d.v.x = a.x * i + c.x;\n" +
+		"  circle([-p.x, d.v.x], 3, 4);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	stmts := prog.Func("main").Body.Stmts
+	asig, ok := stmts[0].(*AssignStmt)
+	if !ok {
+		t.Fatalf("bad asignation: %+v", stmts[0])
+	}
+	sel, ok := asig.Target.(*SelectorExpr)
+	if !ok || sel.Sel.Name != "x" {
+		t.Fatalf("bad target: %+v", asig.Target)
+	}
+	if sel, ok := sel.X.(*SelectorExpr); !ok || sel.Sel.Name != "v" || sel.X.(*Ident).Name != "d" {
+		t.Errorf("bad target: %+v", sel.X)
+	}
+	sum, ok := asig.Value.(*BinaryExpr)
+	if !ok || sum.Op != TokType('+') {
+		t.Fatalf("bad value: %+v", asig.Value)
+	}
+	if _, ok := sum.Y.(*SelectorExpr); !ok {
+		t.Errorf("bad value: %+v", sum.Y)
+	}
+	call := stmts[1].(*CallStmt)
+	lit, ok := call.Args[0].(*CoordLit)
+	if !ok {
+		t.Fatalf("bad argument: %+v", call.Args[0])
+	}
+	if neg, ok := lit.X.(*UnaryExpr); !ok {
+		t.Errorf("bad argument: %+v", lit.X)
+	} else if _, ok := neg.X.(*SelectorExpr); !ok {
+		t.Errorf("bad argument: %+v", neg.X)
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+
+	const text = "type record vector(int x, int y, int z)\n" +
+		"func main(int a, bool b){\n" +
+		"  a.x = 3;\n" +
+		"  iter (i := 0; 3, 1){\n" +
+		"    circle([i.y, b.z.w], 3, 4);\n" +
+		"  }\n" +
+		"}\n"
+
+	_, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:3:4: Bad selector .x on int value",
+		"tree_test.fx:5:14: Bad selector .y on int value",
+		"tree_test.fx:5:19: Bad selector .z on bool value",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if !strings.HasPrefix(errs[i].Error(), w) {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+
+	_, errs = parseString(t, "func main(){\n  v. = 3;\n}\n")
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "tree_test.fx:2:6: Expected field id in field selector") {
+		t.Errorf("bad selector errors: %v", errs)
+	}
+}
+
+func TestCoord(t *testing.T) {
+
+	const text = "func main(){\n" +
+		"  Coord pp;\n" +
+		"  pp = [4, 45];\n" +
+		"  pp.x = [pp.y * 2, -1].y;\n" +
+		"  circle([0x46, 4], 2, 3);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	stmts := prog.Func("main").Body.Stmts
+	if decl, ok := stmts[0].(*VarDecl); !ok || decl.TypeName != "Coord" || decl.Name != "pp" {
+		t.Errorf("bad declaration: %+v", stmts[0])
+	}
+	lit, ok := stmts[1].(*AssignStmt).Value.(*CoordLit)
+	if !ok || lit.X.(*IntLit).Value != 4 || lit.Y.(*IntLit).Value != 45 {
+		t.Errorf("bad Coord literal: %+v", stmts[1].(*AssignStmt).Value)
+	}
+	sel, ok := stmts[2].(*AssignStmt).Value.(*SelectorExpr)
+	if !ok {
+		t.Fatalf("bad value: %+v", stmts[2].(*AssignStmt).Value)
+	}
+	if lit, ok := sel.X.(*CoordLit); !ok {
+		t.Errorf("bad Coord literal: %+v", sel.X)
+	} else if _, ok := lit.X.(*BinaryExpr); !ok {
+		t.Errorf("bad Coord component: %+v", lit.X)
+	}
+
+	_, errs = parseString(t, "func main(){\n  Coord p;\n  p.z = [1, 2].w;\n}\n")
+	if len(errs) != 2 || !strings.HasPrefix(errs[0].Error(), "tree_test.fx:3:5: Record Coord has no field z") ||
+		!strings.HasPrefix(errs[1].Error(), "tree_test.fx:3:16: Record Coord has no field w") {
+		t.Errorf("bad Coord errors: %v", errs)
+	}
+
+	_, errs = parseString(t, "func main(){\n  p = [1 2];\n  p = [1, 2;\n}\n")
+	if len(errs) != 2 || !strings.HasPrefix(errs[0].Error(), "tree_test.fx:2:10: Expected , in Coord literal") ||
+		!strings.HasPrefix(errs[1].Error(), "tree_test.fx:3:12: Expected ] in Coord literal") {
+		t.Errorf("bad Coord errors: %v", errs)
+	}
+}
+
+func TestRecordVars(t *testing.T) {
+
+	//the records can be used before they are declared
+	const text = "func line(vector v, int n){\n" +
+		"  difficult d;\n" +
+		"  d.v.z = v.x * n;\n" +
+		"  d.r = [d.v.x, d.v.y];\n" +
+		"}\n" +
+		"type record vector(int x, int y, int z)\n" +
+		"type record difficult (vector v, Coord r)\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	line := prog.Func("line")
+	if line.Params[0].TypeName != "vector" || line.Params[1].TypeName != "int" {
+		t.Errorf("bad params: %+v %+v", line.Params[0], line.Params[1])
+	}
+	if decl, ok := line.Body.Stmts[0].(*VarDecl); !ok || decl.TypeName != "difficult" {
+		t.Errorf("bad declaration: %+v", line.Body.Stmts[0])
+	}
+
+	_, errs = parseString(t, "func line(vectr v){\n  vector w;\n  w.x = v.x;\n}\n"+
+		"type record vector(int x, int y, int z)\n")
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "tree_test.fx:1:11: Unknown type vectr") {
+		t.Errorf("bad type errors: %v", errs)
+	}
+}
+
+func TestLangFile(t *testing.T) {
+
+	filename := fxtest.LangFile()
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var myLexer *Lexer = NewLexer(reader, filename, true)
+	var myParser *Parser = NewParser(myLexer)
+	myParser.DebugDesc = false
+	prog, errs := myParser.Parse()
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if len(prog.Records) != 2 || len(prog.Funcs) != 2 {
+		t.Errorf("expected 2 records and 2 funcs, got %d and %d", len(prog.Records), len(prog.Funcs))
+	}
+	iter := prog.Func("line").Body.Stmts[1].(*IterStmt)
+	if sel, ok := iter.End.(*SelectorExpr); !ok || sel.Sel.Name != "z" {
+		t.Errorf("bad iter bound: %+v", iter.End)
+	}
+	if p := prog.Files.Position(iter.End.Token().Pos); p.File != filename || p.Line != 26 || p.Col != 17 {
+		t.Errorf("iter bound at %s", p)
+	}
+}
+
+func TestBind(t *testing.T) {
+
+	const text = "type record vector(int x, int y, int z)\n" +
+		"func line(vector v){\n" +
+		"  int n;\n" +
+		"  iter (i := 0, v.z, 1){\n" +
+		"    n = v.x * i;\n" +
+		"    circle([n, i], 2, 1);\n" +
+		"  }\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  vector v;\n" +
+		"  line(v);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	line := prog.Func("line")
+	if prog.Scope.Lookup("line") != line.Sym || prog.Scope.Lookup("vector").Kind != fxsym.SType {
+		t.Errorf("bad program scope")
+	}
+	v := line.Params[0].Sym
+	if v.Kind != fxsym.SVar || v.Type != prog.Record("vector").Sym.Type || v.Pos.Line != 2 {
+		t.Errorf("bad param symbol: %v", v)
+	}
+	iter := line.Body.Stmts[1].(*IterStmt)
+	if iter.End.(*SelectorExpr).X.(*Ident).Sym != v {
+		t.Errorf("iter bound not bound to the parameter")
+	}
+	asig := iter.Body.Stmts[0].(*AssignStmt)
+	if asig.Target.(*Ident).Sym != line.Body.Stmts[0].(*VarDecl).Sym {
+		t.Errorf("target not bound to the local")
+	}
+	if asig.Value.(*BinaryExpr).Y.(*Ident).Sym != iter.Var.Sym || iter.Var.Sym.Type != fxsym.TypeInt {
+		t.Errorf("iter variable not bound")
+	}
+	if call := iter.Body.Stmts[1].(*CallStmt); call.Sym == nil || call.Sym.Kind != fxsym.SBuiltin {
+		t.Errorf("builtin not bound: %v", call.Sym)
+	}
+	main := prog.Func("main")
+	if call := main.Body.Stmts[1].(*CallStmt); call.Sym != line.Sym {
+		t.Errorf("call not bound: %v", call.Sym)
+	}
+}
+
+func TestUndeclared(t *testing.T) {
+
+	const text = "func hola(int x, int x){\n" +
+		"  circle([1, y], 2, 3);\n" +
+		"  iter (i := 0; x, 1){\n" +
+		"    int k;\n" +
+		"    bool k;\n" +
+		"  }\n" +
+		"  hello(i);\n" +
+		"}\n"
+
+	_, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:1:22: Duplicate parameter x in function hola",
+		"tree_test.fx:2:14: Undeclared variable y in function hola",
+		"tree_test.fx:5:10: Duplicate declaration of k in function hola, previously declared at tree_test.fx:4:9",
+		"tree_test.fx:7:3: Undeclared function hello in function hola",
+		"tree_test.fx:7:9: Iter variable i used outside its loop in function hola",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+
+	const text = "type record vector(int x)\n" +
+		"func line(int n){\n" +
+		"  int n;\n" +
+		"  iter (i := 0; n, 1){\n" +
+		"    int n;\n" +
+		"    n = i;\n" +
+		"  }\n" +
+		"}\n" +
+		"func line(){\n" +
+		"  line = vector;\n" +
+		"}\n" +
+		"func circle(){\n" +
+		"  n(1);\n" +
+		"}\n"
+
+	_, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:9:6: Function line redeclared in program, previously declared at tree_test.fx:2:6",
+		"tree_test.fx:12:6: Function circle redeclared in program, it is a builtin",
+		"tree_test.fx:3:7: Duplicate declaration of n in function line, previously declared at tree_test.fx:2:15",
+		"tree_test.fx:10:3: func line used as a variable in function line",
+		"tree_test.fx:10:10: type vector used as a variable in function line",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+
+	_, errs = parseString(t, "func main(int n){\n  n(1);\n}\n")
+	if len(errs) != 1 || errs[0].Error() != "tree_test.fx:2:3: var n called as a function in function main" {
+		t.Errorf("bad call errors: %v", errs)
+	}
+}
+
+func TestTypes(t *testing.T) {
+
+	const text = "type record vector(int x, bool b, Coord c)\n" +
+		"func main(vector v, int n, bool a){\n" +
+		"  Coord p;\n" +
+		"  p = [n + 1, v.c.y * 2];\n" +
+		"  a = n <= 3 | !v.b & n == v.x;\n" +
+		"  if (a ^ v.b){\n" +
+		"    n = -v.c.x ** 2 % 3;\n" +
+		"  }\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	body := prog.Func("main").Body.Stmts
+	p := body[1].(*AssignStmt)
+	if typ := prog.TypeOf(p.Value); typ != fxsym.TypeCoord {
+		t.Errorf("Coord literal has type %v", typ)
+	}
+	a := body[2].(*AssignStmt)
+	if typ := prog.TypeOf(a.Value); typ != fxsym.TypeBool {
+		t.Errorf("bool expression has type %v", typ)
+	}
+	cond := body[3].(*IfStmt).Cond
+	if typ := prog.TypeOf(cond); typ != fxsym.TypeBool {
+		t.Errorf("if condition has type %v", typ)
+	}
+	n := body[3].(*IfStmt).Then.Stmts[0].(*AssignStmt)
+	if typ := prog.TypeOf(n.Value); typ != fxsym.TypeInt {
+		t.Errorf("int expression has type %v", typ)
+	}
+	if typ := prog.TypeOf(n.Target); typ != fxsym.TypeInt {
+		t.Errorf("assigned variable has type %v", typ)
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+
+	const text = "type record vector(int x)\n" +
+		"func main(vector v, int n, bool a){\n" +
+		"  n = a;\n" +
+		"  a = n + a;\n" +
+		"  n = !n;\n" +
+		"  if (n){\n" +
+		"    v = [True, n];\n" +
+		"  }\n" +
+		"}\n"
+
+	_, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:3:5: Cannot assign bool to int in asignation",
+		"tree_test.fx:4:9: Bad operands int, bool for operator +",
+		"tree_test.fx:5:7: Bad operand int for operator !",
+		"tree_test.fx:6:7: Condition of type int in if statement, must be bool",
+		"tree_test.fx:7:10: Coord component of type bool in Coord literal, must be int",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+
+	const iterText = "func main(int n, bool a){\n" +
+		"  iter (i := a; n == 1, 1){\n" +
+		"    n = i == 2;\n" +
+		"  }\n" +
+		"}\n"
+
+	_, errs = parseString(t, iterText)
+	wanted = []string{
+		"tree_test.fx:2:14: Iter start of type bool in iter statement, must be int",
+		"tree_test.fx:2:19: Iter bound of type bool in iter statement, must be int",
+		"tree_test.fx:3:7: Cannot assign bool to int in asignation",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestCalls(t *testing.T) {
+
+	const text = "func line(Coord p, int n){\n" +
+		"  circle(p, n, 0xff);\n" +
+		"}\n" +
+		"func main(int y){\n" +
+		"  circle([1, 2], True, 3);\n" +
+		"  circle([1, 2], y, y, 5);\n" +
+		"  rect(y);\n" +
+		"  line(2, 3);\n" +
+		"  line([2, 3]);\n" +
+		"}\n"
+
+	_, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:5:18: Argument r of type bool in call to circle, must be int",
+		"tree_test.fx:6:3: Call to circle with 4 arguments instead of 3 (Coord p, int r, int color)",
+		"tree_test.fx:7:3: Call to rect with 1 arguments instead of 3 (Coord p, int angle, int color)",
+		"tree_test.fx:8:8: Argument p of type int in call to line, must be Coord",
+		"tree_test.fx:9:3: Call to line with 1 arguments instead of 2 (Coord p, int n)",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+
+	const text = "type record vector(int x, int y, int z)\n" +
+		"\n" +
+		"func f(vector v, bool b){\n" +
+		"\tint a;\n" +
+		"\ta = -(v.x + 2) * 3 ** 2 - (v.y - v.z);\n" +
+		"\ta = (-2) ** 2 + -2 ** 2 - -a;\n" +
+		"\tb = !(a > 3) | b & a == 2;\n" +
+		"\tif (b ^ True) {\n" +
+		"\t\tcircle([a, a / (2 * 3)], [a, 2].y, 0x1f);\n" +
+		"\t} else if (False) {\n" +
+		"\t\titer (i := 0, v.z, 2){\n" +
+		"\t\t\trect([i, i], 5, 255);\n" +
+		"\t\t}\n" +
+		"\t} else {\n" +
+		"\t\ta = 1;\n" +
+		"\t}\n" +
+		"}\n" +
+		"\n" +
+		"func main(){\n" +
+		"\tvector v;\n" +
+		"\tf(v, True);\n" +
+		"}\n"
+	const want = "type record vector(int x, int y, int z)\n" +
+		"\n" +
+		"func f(vector v, bool b){\n" +
+		"\tint a;\n" +
+		"\ta = -(v.x + 2) * 3 ** 2 - (v.y - v.z);\n" +
+		"\ta = (-2) ** 2 + -2 ** 2 - -a;\n" +
+		"\tb = !(a > 3) | b & a == 2;\n" +
+		"\tif (b ^ True) {\n" +
+		"\t\tcircle([a, a / (2 * 3)], [a, 2].y, 31);\n" +
+		"\t} else if (False) {\n" +
+		"\t\titer (i := 0, v.z, 2){\n" +
+		"\t\t\trect([i, i], 5, 255);\n" +
+		"\t\t}\n" +
+		"\t} else {\n" +
+		"\t\ta = 1;\n" +
+		"\t}\n" +
+		"}\n" +
+		"\n" +
+		"func main(){\n" +
+		"\tvector v;\n" +
+		"\tf(v, True);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	var out strings.Builder
+	if err := Fprint(&out, prog); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("printed\n%s\nshould be\n%s", out.String(), want)
+	}
+	//the output parses to the same program
+	prog, errs = parseString(t, out.String())
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	var again strings.Builder
+	Fprint(&again, prog)
+	if again.String() != want {
+		t.Errorf("printed again\n%s\nshould be\n%s", again.String(), want)
+	}
+}
+
+func TestCallGraph(t *testing.T) {
+
+	const text = "func a(int n){\n" +
+		"  b(n);\n" +
+		"  circle([n, n], n, n);\n" +
+		"}\n" +
+		"func b(int n){\n" +
+		"  if (n > 0) {\n" +
+		"    a(n - 1);\n" +
+		"  } else {\n" +
+		"    c();\n" +
+		"  }\n" +
+		"}\n" +
+		"func c(){\n" +
+		"  c();\n" +
+		"}\n" +
+		"func unused(){\n" +
+		"  rect([0, 0], 1, 2);\n" +
+		"  undeclared();\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  iter (i := 0, 2, 1){\n" +
+		"    a(i);\n" +
+		"  }\n" +
+		"}\n"
+
+	//the call to undeclared is an error, the graph is built anyway
+	prog, errs := parseString(t, text)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	g := NewCallGraph(prog)
+	if callees := g.Callees(prog.Func("b")); len(callees) != 2 || callees[0].Name != "a" || callees[1].Name != "c" {
+		t.Errorf("bad callees of b: %v", callees)
+	}
+	errs = g.Errors()
+	wanted := []string{
+		"tree_test.fx:7:5: Recursive call to a in cycle a -> b -> a",
+		"tree_test.fx:13:3: Recursive call to c in cycle c -> c",
+		"tree_test.fx:15:6: Function unused unreachable from main",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+
+	const dot = "digraph \"tree_test.fx\" {\n" +
+		"\t\"a\";\n" +
+		"\t\"b\";\n" +
+		"\t\"c\";\n" +
+		"\t\"unused\" [style=dashed];\n" +
+		"\t\"main\";\n" +
+		"\t\"circle\" [shape=box];\n" +
+		"\t\"rect\" [shape=box];\n" +
+		"\t\"a\" -> \"b\";\n" +
+		"\t\"a\" -> \"circle\";\n" +
+		"\t\"b\" -> \"a\" [color=red];\n" +
+		"\t\"b\" -> \"c\";\n" +
+		"\t\"c\" -> \"c\" [color=red];\n" +
+		"\t\"unused\" -> \"rect\";\n" +
+		"\t\"main\" -> \"a\";\n" +
+		"}\n"
+	var out strings.Builder
+	if err := g.WriteDot(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != dot {
+		t.Errorf("dot is\n%s\nshould be\n%s", out.String(), dot)
+	}
+}
+
+func TestCallGraphMain(t *testing.T) {
+
+	prog, _ := parseString(t, "func f(){\n  circle([1, 2], 3, 4);\n}\n")
+	errs := NewCallGraph(prog).Errors()
+	if len(errs) != 1 || errs[0].Error() != "tree_test.fx: No function main" {
+		t.Errorf("expected a missing main error, got %v", errs)
+	}
+
+	//Parse fails on the redeclaration, the graph is built anyway
+	prog, _ = parseString(t, "func main(){\n  f();\n}\n"+
+		"func f(){\n  circle([1, 2], 3, 4);\n}\n"+
+		"func main(){\n  circle([1, 2], 3, 4);\n}\n")
+	errs = NewCallGraph(prog).Errors()
+	want := "tree_test.fx:7:6: Function main redeclared in program, previously declared at tree_test.fx:1:6"
+	if len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("expected a duplicated main error, got %v", errs)
+	}
+}
+
+func TestRecursion(t *testing.T) {
+
+	const text = "func a(int n){\n" +
+		"  b(n);\n" +
+		"}\n" +
+		"func b(int n){\n" +
+		"  if (n > 0) {\n" +
+		"    a(n - 1);\n" +
+		"  }\n" +
+		"}\n" +
+		"func f(){\n" +
+		"  circle([0, 0], 1, 1);\n" +
+		"  f();\n" +
+		"}\n" +
+		"func main(){\n" +
+		"  a(2);\n" +
+		"  f();\n" +
+		"}\n"
+
+	//each cycle is reported once, at the call leaving its first func
+	_, errs := parseString(t, text)
+	wanted := []string{
+		"tree_test.fx:2:3: Recursive call to b in cycle a -> b -> a",
+		"tree_test.fx:11:3: Recursive call to f in cycle f -> f",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+
+	prog, errs := parseString(t, "func main(){\n  int a;\n  a = 3 @ + 0x;\n  a = # 2;\n}\n")
+	wanted := []string{
+		"tree_test.fx:3:9: Bad character '@'",
+		"tree_test.fx:3:13: Missing digits in hexadecimal literal 0x",
+		"tree_test.fx:4:7: Bad character '#'",
+	}
+	if len(errs) != len(wanted) {
+		t.Fatalf("expected %d errors, got %v", len(wanted), errs)
+	}
+	for i, w := range wanted {
+		if errs[i].Error() != w {
+			t.Errorf("error %d is %q, should be %q", i, errs[i], w)
+		}
+	}
+	//the bad characters are skipped
+	if assign, ok := prog.Funcs[0].Body.Stmts[2].(*AssignStmt); !ok || assign.Value.(*IntLit).Value != 2 {
+		t.Errorf("bad recovery: %#v", prog.Funcs[0].Body.Stmts[2])
+	}
+}
+
+func TestDoc(t *testing.T) {
+
+	const text = "/* a point\n   in space */\n" +
+		"type record vector(int x, int y, int z)\n\n" +
+		"//draws\n//a circle\n" +
+		"func ball(int x){\n" +
+		"  circle([x, x], 2, 2);\n" +
+		"}\n\n" +
+		"//not for main\n\n" +
+		"func main(){\n" +
+		"  ball(3);\n" +
+		"}\n"
+
+	prog, errs := parseString(t, text)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if doc := prog.Record("vector").Doc.Text(); doc != "a point\nin space" {
+		t.Errorf("vector has doc %q", doc)
+	}
+	if doc := prog.Func("ball").Doc.Text(); doc != "draws\na circle" {
+		t.Errorf("ball has doc %q", doc)
+	}
+	if doc := prog.Func("main").Doc; doc != nil {
+		t.Errorf("main has doc %+v", doc)
+	}
+}
+
+func TestDiag(t *testing.T) {
+
+	var diag strings.Builder
+	p := NewParser(NewLexer(bufio.NewReader(strings.NewReader("func main(){\n  int a;\n  a = ;\n}\n")), "tree_test.fx"))
+	p.DebugDesc = false
+	p.Diag = &diag
+	_, errs := p.Parse()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	if want := errs[0].Error() + "\nSYNTAX ERROR\n"; diag.String() != want {
+		t.Errorf("printed %q, should be %q", diag.String(), want)
+	}
+}
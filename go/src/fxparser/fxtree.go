@@ -1,21 +1,253 @@
 package fxparser
 
-//import("fxlex")
-
-const (
-	SProg = iota
-	SFunc
-	SFsig
-	SFdecargs
-	SBody
-	SStatement
-	SFuncall
-	SFargs
-	SExpr
-	SAtom
-	SIter
+import (
+	"fxlex"
+	"fxsym"
 )
 
-type Sym struct {
-	sType int
+//Node is implemented by every node of the tree. Token returns the token
+//the node was built from, so every node knows its place in the source.
+type Node interface {
+	Token() fxlex.Token
+}
+
+//Stmt is implemented by the statements that can appear in a <BODY>
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+//Expr is implemented by the expression nodes
+type Expr interface {
+	Node
+	exprNode()
+}
+
+//<PROG>, the symbols are bound by resolve once the program is parsed
+//and the types of the expressions are set by typecheck. Files has the
+//source file, to find the Pos of the tokens.
+type Program struct {
+	Tok     fxlex.Token
+	Files   *fxlex.FileSet
+	Records []*RecordDecl
+	Funcs   []*FuncDecl
+	Scope   *fxsym.Scope
+	Types   map[Expr]*fxsym.Type
+}
+
+//<RECORD>, Tok is the record name
+type RecordDecl struct {
+	Tok    fxlex.Token
+	Name   string
+	Fields []*Field
+	Sym    *fxsym.Sym
+	//the comments right above the declaration
+	Doc *fxlex.CommentGroup
+}
+
+//one of the <FIELDS>, Tok is the field name
+type Field struct {
+	Tok      fxlex.Token
+	Name     string
+	TypeTok  fxlex.Token
+	TypeName string
+}
+
+//<FUNC>, Tok is the function name
+type FuncDecl struct {
+	Tok    fxlex.Token
+	Name   string
+	Params []*Param
+	Body   *Block
+	Sym    *fxsym.Sym
+	Scope  *fxsym.Scope
+	//the comments right above the declaration
+	Doc *fxlex.CommentGroup
+}
+
+//one of the <FDECARGS>, Tok is the parameter name
+type Param struct {
+	Tok      fxlex.Token
+	Name     string
+	TypeTok  fxlex.Token
+	TypeName string
+	Sym      *fxsym.Sym
+}
+
+//'{' <BODY> '}'
+type Block struct {
+	Tok   fxlex.Token
+	Stmts []Stmt
+}
+
+//id <FUNCALL>, Tok is the called id
+type CallStmt struct {
+	Tok  fxlex.Token
+	Name string
+	Args []Expr
+	Sym  *fxsym.Sym
+}
+
+//id '=' <EXPR> ';', Tok is the '='
+type AssignStmt struct {
+	Tok    fxlex.Token
+	Target Expr
+	Value  Expr
+}
+
+//type id ';', Tok is the declared id
+type VarDecl struct {
+	Tok      fxlex.Token
+	Name     string
+	TypeTok  fxlex.Token
+	TypeName string
+	Sym      *fxsym.Sym
+}
+
+//<ITER>, Tok is 'iter'
+type IterStmt struct {
+	Tok   fxlex.Token
+	Var   *Ident
+	Start Expr
+	End   Expr
+	Step  Expr
+	Body  *Block
+}
+
+//<IF>, Tok is 'if'. Else is nil, a *Block or the *IfStmt of an else if
+type IfStmt struct {
+	Tok  fxlex.Token
+	Cond Expr
+	Then *Block
+	Else Stmt
+}
+
+//<ATOM> id
+type Ident struct {
+	Tok  fxlex.Token
+	Name string
+	Sym  *fxsym.Sym
+}
+
+//<ATOM> intval
+type IntLit struct {
+	Tok   fxlex.Token
+	Value int64
+}
+
+//<ATOM> boolVal
+type BoolLit struct {
+	Tok   fxlex.Token
+	Value bool
+}
+
+//unop <EXPR>, Tok is the operator
+type UnaryExpr struct {
+	Tok fxlex.Token
+	Op  fxlex.TokType
+	X   Expr
+}
+
+//<EXPR> binop <EXPR>, Tok is the operator
+type BinaryExpr struct {
+	Tok fxlex.Token
+	Op  fxlex.TokType
+	X   Expr
+	Y   Expr
+}
+
+//<EXPR> '.' id, Tok is the '.'
+type SelectorExpr struct {
+	Tok fxlex.Token
+	X   Expr
+	Sel *Ident
+}
+
+//'[' <EXPR> ',' <EXPR> ']', Tok is the '['
+type CoordLit struct {
+	Tok fxlex.Token
+	X   Expr
+	Y   Expr
+}
+
+func (n *Program) Token() fxlex.Token      { return n.Tok }
+func (n *RecordDecl) Token() fxlex.Token   { return n.Tok }
+func (n *Field) Token() fxlex.Token        { return n.Tok }
+func (n *FuncDecl) Token() fxlex.Token     { return n.Tok }
+func (n *Param) Token() fxlex.Token        { return n.Tok }
+func (n *Block) Token() fxlex.Token        { return n.Tok }
+func (n *CallStmt) Token() fxlex.Token     { return n.Tok }
+func (n *AssignStmt) Token() fxlex.Token   { return n.Tok }
+func (n *VarDecl) Token() fxlex.Token      { return n.Tok }
+func (n *IterStmt) Token() fxlex.Token     { return n.Tok }
+func (n *IfStmt) Token() fxlex.Token       { return n.Tok }
+func (n *Ident) Token() fxlex.Token        { return n.Tok }
+func (n *IntLit) Token() fxlex.Token       { return n.Tok }
+func (n *BoolLit) Token() fxlex.Token      { return n.Tok }
+func (n *UnaryExpr) Token() fxlex.Token    { return n.Tok }
+func (n *BinaryExpr) Token() fxlex.Token   { return n.Tok }
+func (n *SelectorExpr) Token() fxlex.Token { return n.Tok }
+func (n *CoordLit) Token() fxlex.Token     { return n.Tok }
+
+func (*CallStmt) stmtNode()   {}
+func (*AssignStmt) stmtNode() {}
+func (*VarDecl) stmtNode()    {}
+func (*IterStmt) stmtNode()   {}
+func (*IfStmt) stmtNode()     {}
+func (*Block) stmtNode()      {}
+
+func (*Ident) exprNode()        {}
+func (*IntLit) exprNode()       {}
+func (*BoolLit) exprNode()      {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*SelectorExpr) exprNode() {}
+func (*CoordLit) exprNode()     {}
+
+//Func returns the function declared with name, or nil
+func (n *Program) Func(name string) *FuncDecl {
+	for _, f := range n.Funcs {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+//CoordDecl is the predefined record Coord(int x, int y)
+var CoordDecl = &RecordDecl{
+	Name: "Coord",
+	Fields: []*Field{
+		&Field{Name: "x", TypeName: "int"},
+		&Field{Name: "y", TypeName: "int"},
+	},
+}
+
+//Record returns the record type declared with name, or nil. Coord is
+//always declared.
+func (n *Program) Record(name string) *RecordDecl {
+	if name == CoordDecl.Name {
+		return CoordDecl
+	}
+	for _, r := range n.Records {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+//Field returns the field of the record with name, or nil
+func (n *RecordDecl) Field(name string) *Field {
+	for _, f := range n.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+//TypeOf returns the type of the expression, nil if it is not known
+func (n *Program) TypeOf(e Expr) *fxsym.Type {
+	return n.Types[e]
 }
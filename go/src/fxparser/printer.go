@@ -0,0 +1,151 @@
+package fxparser
+
+import (
+	"bufio"
+	"fmt"
+	"fxlex"
+	"io"
+	"strings"
+)
+
+//Fprint writes the program as fx source, one statement per line and
+//the blocks indented with tabs. Parsing the output gives the same tree.
+//Expressions have only the parenthesis they need.
+func Fprint(w io.Writer, prog *Program) error {
+
+	bw := bufio.NewWriter(w)
+	for _, rec := range prog.Records {
+		fields := []string{}
+		for _, f := range rec.Fields {
+			fields = append(fields, f.TypeName+" "+f.Name)
+		}
+		fmt.Fprintf(bw, "type record %s(%s)\n", rec.Name, strings.Join(fields, ", "))
+	}
+	for i, fn := range prog.Funcs {
+		if i > 0 || len(prog.Records) > 0 {
+			fmt.Fprintln(bw)
+		}
+		params := []string{}
+		for _, p := range fn.Params {
+			params = append(params, p.TypeName+" "+p.Name)
+		}
+		fmt.Fprintf(bw, "func %s(%s){\n", fn.Name, strings.Join(params, ", "))
+		printBlock(bw, fn.Body, 1)
+		fmt.Fprintln(bw, "}")
+	}
+	return bw.Flush()
+}
+
+func printBlock(w io.Writer, block *Block, depth int) {
+	for _, stmt := range block.Stmts {
+		printStmt(w, stmt, depth)
+	}
+}
+
+func printStmt(w io.Writer, stmt Stmt, depth int) {
+
+	indent := strings.Repeat("\t", depth)
+	switch stmt := stmt.(type) {
+	case *VarDecl:
+		fmt.Fprintf(w, "%s%s %s;\n", indent, stmt.TypeName, stmt.Name)
+	case *AssignStmt:
+		fmt.Fprintf(w, "%s%s = %s;\n", indent, ExprString(stmt.Target), ExprString(stmt.Value))
+	case *CallStmt:
+		args := []string{}
+		for _, a := range stmt.Args {
+			args = append(args, ExprString(a))
+		}
+		fmt.Fprintf(w, "%s%s(%s);\n", indent, stmt.Name, strings.Join(args, ", "))
+	case *IterStmt:
+		fmt.Fprintf(w, "%siter (%s := %s, %s, %s){\n", indent, stmt.Var.Name,
+			ExprString(stmt.Start), ExprString(stmt.End), ExprString(stmt.Step))
+		printBlock(w, stmt.Body, depth+1)
+		fmt.Fprintf(w, "%s}\n", indent)
+	case *IfStmt:
+		fmt.Fprintf(w, "%sif (%s) {\n", indent, ExprString(stmt.Cond))
+		printIfEnd(w, stmt, depth)
+	case *Block:
+		printBlock(w, stmt, depth)
+	}
+}
+
+//printIfEnd writes the then block of the if and its else
+func printIfEnd(w io.Writer, stmt *IfStmt, depth int) {
+
+	indent := strings.Repeat("\t", depth)
+	printBlock(w, stmt.Then, depth+1)
+	switch els := stmt.Else.(type) {
+	case nil:
+		fmt.Fprintf(w, "%s}\n", indent)
+	case *IfStmt:
+		fmt.Fprintf(w, "%s} else if (%s) {\n", indent, ExprString(els.Cond))
+		printIfEnd(w, els, depth)
+	case *Block:
+		fmt.Fprintf(w, "%s} else {\n", indent)
+		printBlock(w, els, depth+1)
+		fmt.Fprintf(w, "%s}\n", indent)
+	}
+}
+
+//isUnary tells if the expression prints with a sign in front, folded
+//negative literals too
+func isUnary(e Expr) bool {
+	switch e := e.(type) {
+	case *UnaryExpr:
+		return true
+	case *IntLit:
+		return e.Value < 0
+	}
+	return false
+}
+
+//operand returns the expression as an operand of the binary operator
+//op, in parenthesis if it would group in other way
+func operand(e Expr, op fxlex.TokType, right bool) string {
+
+	s := ExprString(e)
+	if b, ok := e.(*BinaryExpr); ok {
+		prec, parent := precTab[b.Op], precTab[op]
+		if prec < parent || (prec == parent && right != rightTab[op]) {
+			return "(" + s + ")"
+		}
+	}
+	//-a ** b is -(a ** b)
+	if op == fxlex.TokDMul && !right && isUnary(e) {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+//ExprString returns the expression as fx source
+func ExprString(expr Expr) string {
+
+	switch expr := expr.(type) {
+	case *Ident:
+		return expr.Name
+	case *IntLit:
+		return fmt.Sprint(expr.Value)
+	case *BoolLit:
+		if expr.Value {
+			return "True"
+		}
+		return "False"
+	case *CoordLit:
+		return "[" + ExprString(expr.X) + ", " + ExprString(expr.Y) + "]"
+	case *SelectorExpr:
+		x := ExprString(expr.X)
+		if _, ok := expr.X.(*BinaryExpr); ok || isUnary(expr.X) {
+			x = "(" + x + ")"
+		}
+		return x + "." + expr.Sel.Name
+	case *UnaryExpr:
+		x := ExprString(expr.X)
+		if b, ok := expr.X.(*BinaryExpr); (ok && b.Op != fxlex.TokDMul) || isUnary(expr.X) {
+			x = "(" + x + ")"
+		}
+		return string(rune(expr.Op)) + x
+	case *BinaryExpr:
+		return operand(expr.X, expr.Op, false) + " " + expr.Tok.Lexema + " " + operand(expr.Y, expr.Op, true)
+	}
+	return ""
+}
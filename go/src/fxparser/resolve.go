@@ -0,0 +1,167 @@
+package fxparser
+
+import (
+	"fmt"
+	"fxlex"
+	"fxsym"
+)
+
+//resolve is the semantic analysis pass, run once the whole program is
+//parsed so types and functions can be used before they are declared.
+//It builds the scopes of the program (universe, program, function and
+//the blocks of iter and if) and binds every name to its symbol. It
+//reports undeclared and duplicated names, types are checked afterwards
+//by typecheck.
+
+func (p *Parser) resolve(prog *Program) {
+
+	prog.Scope = fxsym.NewScope(fxsym.SProgram, "", fxsym.NewUniverse())
+
+	//the fields of the records are already known to be declared before
+	for _, rec := range prog.Records {
+		t := &fxsym.Type{Kind: fxsym.TRecord, Name: rec.Name}
+		for _, f := range rec.Fields {
+			t.Fields = append(t.Fields, &fxsym.Field{Name: f.Name, Type: p.lookupType(prog.Scope, f.TypeTok)})
+		}
+		rec.Sym = &fxsym.Sym{Name: rec.Name, Kind: fxsym.SType, Type: t, Pos: rec.Tok}
+		prog.Scope.Insert(rec.Sym)
+	}
+
+	for _, fn := range prog.Funcs {
+		fn.Sym = &fxsym.Sym{Name: fn.Name, Kind: fxsym.SFunc, Pos: fn.Tok}
+		dup, shadowed := prog.Scope.Insert(fn.Sym)
+		if dup != nil {
+			p.ErrGeneric("Function "+fn.Name+" redeclared", fn.Tok, "in program, "+declaredAt(dup))
+		} else if shadowed != nil && shadowed.Kind == fxsym.SBuiltin {
+			p.ErrGeneric("Function "+fn.Name+" redeclared", fn.Tok, "in program, it is a builtin")
+		}
+	}
+
+	for _, fn := range prog.Funcs {
+		fn.Scope = fxsym.NewScope(fxsym.SFunction, fn.Name, prog.Scope)
+		p.deadIters = map[string]bool{}
+		for _, param := range fn.Params {
+			t := p.lookupType(prog.Scope, param.TypeTok)
+			if t == nil {
+				p.ErrGeneric("Unknown type "+param.TypeName, param.TypeTok, "in declaration")
+			}
+			param.Sym = &fxsym.Sym{Name: param.Name, Kind: fxsym.SVar, Type: t, Pos: param.Tok}
+			fn.Sym.Params = append(fn.Sym.Params, &fxsym.Param{Name: param.Name, Type: t})
+			if dup, _ := fn.Scope.Insert(param.Sym); dup != nil {
+				p.ErrGeneric("Duplicate parameter "+param.Name, param.Tok, "in function "+fn.Name)
+			}
+		}
+		//the parameters and the outer locals share the function scope
+		if fn.Body != nil {
+			p.resolveBlock(fn.Body, fn.Scope)
+		}
+	}
+}
+
+func declaredAt(sym *fxsym.Sym) string {
+	return fmt.Sprintf("previously declared at %s", sym.Pos.Start)
+}
+
+func inFunc(scope *fxsym.Scope) string {
+	return "in function " + scope.Func().Name
+}
+
+//lookupType returns the type named by the token (int, bool, Coord or a
+//record), nil if there is no such type
+func (p *Parser) lookupType(scope *fxsym.Scope, tok fxlex.Token) *fxsym.Type {
+
+	switch tok.Type {
+	case fxlex.TokDefInt:
+		return fxsym.TypeInt
+	case fxlex.TokDefBool:
+		return fxsym.TypeBool
+	}
+	if sym := scope.Lookup(tok.Lexema); sym != nil && sym.Kind == fxsym.SType {
+		return sym.Type
+	}
+	return nil
+}
+
+func (p *Parser) resolveBlock(block *Block, scope *fxsym.Scope) {
+
+	for _, stmt := range block.Stmts {
+		p.resolveStmt(stmt, scope)
+	}
+}
+
+func (p *Parser) resolveStmt(stmt Stmt, scope *fxsym.Scope) {
+
+	switch stmt := stmt.(type) {
+	case *VarDecl:
+		t := p.lookupType(scope, stmt.TypeTok)
+		if t == nil {
+			p.ErrGeneric("Unknown type "+stmt.TypeName, stmt.TypeTok, "in declaration")
+		}
+		stmt.Sym = &fxsym.Sym{Name: stmt.Name, Kind: fxsym.SVar, Type: t, Pos: stmt.Tok}
+		if dup, _ := scope.Insert(stmt.Sym); dup != nil {
+			p.ErrGeneric("Duplicate declaration of "+stmt.Name, stmt.Tok, inFunc(scope)+", "+declaredAt(dup))
+		}
+	case *AssignStmt:
+		p.resolveExpr(stmt.Target, scope)
+		p.resolveExpr(stmt.Value, scope)
+	case *CallStmt:
+		stmt.Sym = scope.Lookup(stmt.Name)
+		if stmt.Sym == nil {
+			p.ErrGeneric("Undeclared function "+stmt.Name, stmt.Tok, inFunc(scope))
+		} else if stmt.Sym.Kind != fxsym.SFunc && stmt.Sym.Kind != fxsym.SBuiltin {
+			p.ErrGeneric(stmt.Sym.Kind.String()+" "+stmt.Name+" called as a function", stmt.Tok, inFunc(scope))
+		}
+		for _, arg := range stmt.Args {
+			p.resolveExpr(arg, scope)
+		}
+	case *IterStmt:
+		p.resolveExpr(stmt.Start, scope)
+		p.resolveExpr(stmt.End, scope)
+		p.resolveExpr(stmt.Step, scope)
+		//the iter variable is only declared inside the loop
+		inner := fxsym.NewScope(fxsym.SBlock, "iter", scope)
+		if stmt.Var != nil {
+			stmt.Var.Sym = &fxsym.Sym{Name: stmt.Var.Name, Kind: fxsym.SVar, Type: fxsym.TypeInt, Pos: stmt.Var.Tok}
+			inner.Insert(stmt.Var.Sym)
+		}
+		p.resolveBlock(stmt.Body, inner)
+		if stmt.Var != nil {
+			p.deadIters[stmt.Var.Name] = true
+		}
+	case *IfStmt:
+		p.resolveExpr(stmt.Cond, scope)
+		p.resolveBlock(stmt.Then, fxsym.NewScope(fxsym.SBlock, "if", scope))
+		if stmt.Else != nil {
+			p.resolveStmt(stmt.Else, scope)
+		}
+	case *Block:
+		p.resolveBlock(stmt, fxsym.NewScope(fxsym.SBlock, "else", scope))
+	}
+}
+
+func (p *Parser) resolveExpr(expr Expr, scope *fxsym.Scope) {
+
+	switch expr := expr.(type) {
+	case *Ident:
+		expr.Sym = scope.Lookup(expr.Name)
+		switch {
+		case expr.Sym == nil && p.deadIters[expr.Name]:
+			p.ErrGeneric("Iter variable "+expr.Name+" used outside its loop", expr.Tok, inFunc(scope))
+		case expr.Sym == nil:
+			p.ErrGeneric("Undeclared variable "+expr.Name, expr.Tok, inFunc(scope))
+		case expr.Sym.Kind != fxsym.SVar:
+			p.ErrGeneric(expr.Sym.Kind.String()+" "+expr.Name+" used as a variable", expr.Tok, inFunc(scope))
+		}
+	case *UnaryExpr:
+		p.resolveExpr(expr.X, scope)
+	case *BinaryExpr:
+		p.resolveExpr(expr.X, scope)
+		p.resolveExpr(expr.Y, scope)
+	case *CoordLit:
+		p.resolveExpr(expr.X, scope)
+		p.resolveExpr(expr.Y, scope)
+	case *SelectorExpr:
+		//the field is checked by the type checker
+		p.resolveExpr(expr.X, scope)
+	}
+}
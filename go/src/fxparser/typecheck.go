@@ -0,0 +1,210 @@
+package fxparser
+
+import (
+	"fmt"
+	"fxlex"
+	"fxsym"
+)
+
+//typecheck is run after resolve. It assigns a type to every expression
+//(Program.Types) and checks the rules of fx:
+//	int operators:  + - * / % ** and the comparisons < <= > >=
+//	bool operators: | & ! ^
+//	== compares two ints or two bools
+//	if conditions are bool and iter bounds are int
+//	the components of a Coord literal are int
+//	the value of an asignation has the type of the target
+//	calls to funcs and builtins match the signature of the callee
+//Expressions that already had errors (undeclared names) have no type
+//and are not reported again.
+
+var intOps = map[fxlex.TokType]bool{
+	fxlex.TokType('+'): true,
+	fxlex.TokType('-'): true,
+	fxlex.TokType('*'): true,
+	fxlex.TokType('/'): true,
+	fxlex.TokType('%'): true,
+	fxlex.TokDMul:      true,
+}
+
+var cmpOps = map[fxlex.TokType]bool{
+	fxlex.TokType('<'): true,
+	fxlex.TokType('>'): true,
+	fxlex.TokSmaller:   true,
+	fxlex.TokGreater:   true,
+}
+
+var boolOps = map[fxlex.TokType]bool{
+	fxlex.TokType('|'): true,
+	fxlex.TokType('&'): true,
+	fxlex.TokType('^'): true,
+	fxlex.TokType('!'): true,
+}
+
+func (p *Parser) typecheck(prog *Program) {
+
+	prog.Types = map[Expr]*fxsym.Type{}
+	for _, fn := range prog.Funcs {
+		if fn.Body != nil {
+			p.checkBlock(prog, fn.Body)
+		}
+	}
+}
+
+func (p *Parser) checkBlock(prog *Program, block *Block) {
+
+	for _, stmt := range block.Stmts {
+		p.checkStmt(prog, stmt)
+	}
+}
+
+func (p *Parser) checkStmt(prog *Program, stmt Stmt) {
+
+	switch stmt := stmt.(type) {
+	case *AssignStmt:
+		tt := p.checkExpr(prog, stmt.Target)
+		vt := p.checkExpr(prog, stmt.Value)
+		if tt != nil && vt != nil && tt != vt {
+			p.ErrGeneric("Cannot assign "+vt.Name+" to "+tt.Name, stmt.Tok, "in asignation")
+		}
+	case *CallStmt:
+		p.checkCall(prog, stmt)
+	case *IterStmt:
+		p.checkInt(prog, stmt.Start, "start")
+		p.checkInt(prog, stmt.End, "bound")
+		p.checkInt(prog, stmt.Step, "step")
+		p.checkBlock(prog, stmt.Body)
+	case *IfStmt:
+		if t := p.checkExpr(prog, stmt.Cond); t != nil && t != fxsym.TypeBool {
+			tok := stmt.Cond.Token()
+			p.ErrGeneric("Condition of type "+t.Name, tok, "in if statement, must be bool")
+		}
+		p.checkBlock(prog, stmt.Then)
+		if stmt.Else != nil {
+			p.checkStmt(prog, stmt.Else)
+		}
+	case *Block:
+		p.checkBlock(prog, stmt)
+	}
+}
+
+//checkCall checks the arguments against the parameters of the func or
+//builtin, parameters with unknown types were already reported
+func (p *Parser) checkCall(prog *Program, call *CallStmt) {
+
+	types := []*fxsym.Type{}
+	for _, arg := range call.Args {
+		types = append(types, p.checkExpr(prog, arg))
+	}
+	sym := call.Sym
+	if sym == nil || (sym.Kind != fxsym.SFunc && sym.Kind != fxsym.SBuiltin) {
+		return
+	}
+	if len(call.Args) != len(sym.Params) {
+		msg := fmt.Sprintf("Call to %s with %d arguments", call.Name, len(call.Args))
+		place := fmt.Sprintf("instead of %d %s", len(sym.Params), sym.Signature())
+		p.ErrGeneric(msg, call.Tok, place)
+		return
+	}
+	for i, param := range sym.Params {
+		if types[i] != nil && param.Type != nil && types[i] != param.Type {
+			tok := call.Args[i].Token()
+			p.ErrGeneric("Argument "+param.Name+" of type "+types[i].Name, tok, "in call to "+call.Name+", must be "+param.Type.Name)
+		}
+	}
+}
+
+func (p *Parser) checkInt(prog *Program, expr Expr, what string) {
+
+	if t := p.checkExpr(prog, expr); t != nil && t != fxsym.TypeInt {
+		tok := expr.Token()
+		p.ErrGeneric("Iter "+what+" of type "+t.Name, tok, "in iter statement, must be int")
+	}
+}
+
+//checkExpr returns the type of the expression, nil if it has errors
+func (p *Parser) checkExpr(prog *Program, expr Expr) (t *fxsym.Type) {
+
+	defer func() {
+		if t != nil {
+			prog.Types[expr] = t
+		}
+	}()
+
+	switch expr := expr.(type) {
+	case *IntLit:
+		return fxsym.TypeInt
+	case *BoolLit:
+		return fxsym.TypeBool
+	case *Ident:
+		if expr.Sym != nil && expr.Sym.Kind == fxsym.SVar {
+			return expr.Sym.Type
+		}
+		return nil
+	case *CoordLit:
+		xt := p.checkExpr(prog, expr.X)
+		yt := p.checkExpr(prog, expr.Y)
+		for _, c := range []struct {
+			e Expr
+			t *fxsym.Type
+		}{{expr.X, xt}, {expr.Y, yt}} {
+			if c.t != nil && c.t != fxsym.TypeInt {
+				tok := c.e.Token()
+				p.ErrGeneric("Coord component of type "+c.t.Name, tok, "in Coord literal, must be int")
+			}
+		}
+		return fxsym.TypeCoord
+	case *SelectorExpr:
+		xt := p.checkExpr(prog, expr.X)
+		if xt == nil {
+			return nil
+		}
+		if !xt.IsRecord() {
+			p.ErrGeneric("Bad selector ."+expr.Sel.Name, expr.Tok, "on "+xt.Name+" value")
+			return nil
+		}
+		field := xt.Field(expr.Sel.Name)
+		if field == nil {
+			p.ErrGeneric("Record "+xt.Name+" has no field "+expr.Sel.Name, expr.Sel.Tok, "")
+			return nil
+		}
+		return field.Type
+	case *UnaryExpr:
+		xt := p.checkExpr(prog, expr.X)
+		if xt == nil {
+			return nil
+		}
+		want := fxsym.TypeInt
+		if boolOps[expr.Op] {
+			want = fxsym.TypeBool
+		}
+		if xt != want {
+			p.ErrGeneric("Bad operand "+xt.Name, expr.Tok, "for operator "+expr.Tok.Lexema)
+			return nil
+		}
+		return want
+	case *BinaryExpr:
+		xt := p.checkExpr(prog, expr.X)
+		yt := p.checkExpr(prog, expr.Y)
+		if xt == nil || yt == nil {
+			return nil
+		}
+		var ok bool
+		switch {
+		case intOps[expr.Op]:
+			ok, t = xt == fxsym.TypeInt && yt == fxsym.TypeInt, fxsym.TypeInt
+		case cmpOps[expr.Op]:
+			ok, t = xt == fxsym.TypeInt && yt == fxsym.TypeInt, fxsym.TypeBool
+		case boolOps[expr.Op]:
+			ok, t = xt == fxsym.TypeBool && yt == fxsym.TypeBool, fxsym.TypeBool
+		case expr.Op == fxlex.TokEqual:
+			ok, t = xt == yt && (xt == fxsym.TypeInt || xt == fxsym.TypeBool), fxsym.TypeBool
+		}
+		if !ok {
+			p.ErrGeneric("Bad operands "+xt.Name+", "+yt.Name, expr.Tok, "for operator "+expr.Tok.Lexema)
+			return nil
+		}
+		return t
+	}
+	return nil
+}
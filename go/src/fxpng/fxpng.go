@@ -0,0 +1,96 @@
+package fxpng
+
+import (
+	"fxcanvas"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+//Canvas rasterises the drawing of an fx program in an image. The
+//coordinates are pixels, the origin is the top left corner and y grows
+//downwards. The shapes are anti-aliased taking samples x samples
+//samples in every pixel and blended over what is already drawn.
+
+const samples = 4
+
+type Canvas struct {
+	Img *image.RGBA
+}
+
+//New returns a width x height canvas filled with background
+func New(width, height int, background color.Color) *Canvas {
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	return &Canvas{Img: img}
+}
+
+func (c *Canvas) Circle(center fxcanvas.Point, radius int64, col fxcanvas.Color) {
+
+	cx, cy, r := float64(center.X), float64(center.Y), math.Abs(float64(radius))
+	bounds := image.Rect(int(math.Floor(cx-r)), int(math.Floor(cy-r)), int(math.Ceil(cx+r))+1, int(math.Ceil(cy+r))+1)
+	c.fill(bounds, col, func(x, y float64) bool {
+		dx, dy := x-cx, y-cy
+		return dx*dx+dy*dy <= r*r
+	})
+}
+
+func (c *Canvas) Rect(corner fxcanvas.Point, angle int64, col fxcanvas.Color) {
+
+	ox, oy := float64(corner.X), float64(corner.Y)
+	sin, cos := math.Sincos(float64(angle%360) * math.Pi / 180)
+	size := float64(fxcanvas.RectSize)
+
+	//the bounds of the four rotated corners
+	minx, miny, maxx, maxy := ox, oy, ox, oy
+	for _, v := range [][2]float64{{size, 0}, {0, size}, {size, size}} {
+		x := ox + v[0]*cos - v[1]*sin
+		y := oy + v[0]*sin + v[1]*cos
+		minx, maxx = math.Min(minx, x), math.Max(maxx, x)
+		miny, maxy = math.Min(miny, y), math.Max(maxy, y)
+	}
+	bounds := image.Rect(int(math.Floor(minx)), int(math.Floor(miny)), int(math.Ceil(maxx))+1, int(math.Ceil(maxy))+1)
+	c.fill(bounds, col, func(x, y float64) bool {
+		//rotate the point back to the square
+		dx, dy := x-ox, y-oy
+		u := dx*cos + dy*sin
+		v := -dx*sin + dy*cos
+		return u >= 0 && u <= size && v >= 0 && v <= size
+	})
+}
+
+//fill blends col over the pixels in bounds, as much as the fraction of
+//their samples inside the shape
+func (c *Canvas) fill(bounds image.Rectangle, col fxcanvas.Color, inside func(x, y float64) bool) {
+
+	bounds = bounds.Intersect(c.Img.Bounds())
+	if bounds.Empty() {
+		return
+	}
+	mask := image.NewAlpha(bounds)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			n := 0
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					x := float64(px) + (float64(sx)+0.5)/samples
+					y := float64(py) + (float64(sy)+0.5)/samples
+					if inside(x, y) {
+						n++
+					}
+				}
+			}
+			mask.SetAlpha(px, py, color.Alpha{A: uint8(n * 0xff / (samples * samples))})
+		}
+	}
+	draw.DrawMask(c.Img, bounds, &image.Uniform{col.NRGBA()}, image.Point{}, mask, bounds.Min, draw.Over)
+}
+
+//Encode writes the image as a PNG
+func (c *Canvas) Encode(w io.Writer) error {
+	return png.Encode(w, c.Img)
+}
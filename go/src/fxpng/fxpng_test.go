@@ -0,0 +1,67 @@
+package fxpng_test
+
+import (
+	"bytes"
+	"fxcanvas"
+	. "fxpng"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func at(c *Canvas, x, y int) color.RGBA {
+	return c.Img.RGBAAt(x, y)
+}
+
+func TestCircle(t *testing.T) {
+
+	c := New(40, 40, color.White)
+	c.Circle(fxcanvas.Point{X: 20, Y: 20}, 10, 0x00ff0000)
+
+	red := color.RGBA{R: 0xff, A: 0xff}
+	if got := at(c, 20, 20); got != red {
+		t.Errorf("center is %v", got)
+	}
+	if got := at(c, 2, 2); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("outside is %v", got)
+	}
+	//the border is anti-aliased, the pixel at 26, 27 is cut by the circle
+	if got := at(c, 26, 27); got.G == 0 || got.G == 0xff {
+		t.Errorf("border is %v", got)
+	}
+}
+
+func TestRect(t *testing.T) {
+
+	c := New(40, 40, color.Black)
+	c.Rect(fxcanvas.Point{X: 20, Y: 20}, 90, 0x0000ff00)
+	c.Rect(fxcanvas.Point{X: 0, Y: 0}, 0, 0x800000ff)
+
+	green := color.RGBA{G: 0xff, A: 0xff}
+	if got := at(c, 15, 25); got != green {
+		t.Errorf("rotated rect is %v at 15, 25", got)
+	}
+	if got := at(c, 25, 25); got != (color.RGBA{A: 0xff}) {
+		t.Errorf("rotated rect is %v at 25, 25", got)
+	}
+	//transparency 0x80 over black
+	if got := at(c, 5, 5); got.B < 0x70 || got.B > 0x80 || got.R != 0 {
+		t.Errorf("transparent rect is %v", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+
+	c := New(8, 4, color.White)
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 8 || img.Bounds().Dy() != 4 {
+		t.Errorf("bad size %v", img.Bounds())
+	}
+}
@@ -0,0 +1,87 @@
+package fxsvg
+
+import (
+	"bytes"
+	"fmt"
+	"fxcanvas"
+	"io"
+	"strings"
+)
+
+//Canvas writes the drawing of an fx program as an SVG document with
+//a <circle> or a <rect> for every call. The output only depends on the
+//calls, so it can be compared with golden files.
+//
+//If Group is set the elements drawn by every call to a user func are
+//inside a <g> with the name of the func and the number of the call as
+//id, main is main-1 and the second call to line is line-2.
+
+type Canvas struct {
+	Width  int
+	Height int
+	Group  bool
+	body   bytes.Buffer
+	depth  int
+	calls  map[string]int
+}
+
+func New(width, height int) *Canvas {
+	return &Canvas{Width: width, Height: height, depth: 1, calls: map[string]int{}}
+}
+
+func (c *Canvas) line(format string, args ...interface{}) {
+	c.body.WriteString(strings.Repeat("  ", c.depth))
+	fmt.Fprintf(&c.body, format, args...)
+	c.body.WriteString("\n")
+}
+
+//fill returns the fill attributes of the color, #rrggbb and the opacity
+func fill(col fxcanvas.Color) string {
+	rgba := col.NRGBA()
+	opacity := float64(rgba.A) / 0xff
+	return fmt.Sprintf(`fill="#%02x%02x%02x" fill-opacity="%.3f"`, rgba.R, rgba.G, rgba.B, opacity)
+}
+
+func (c *Canvas) Circle(center fxcanvas.Point, radius int64, col fxcanvas.Color) {
+	if radius < 0 {
+		radius = -radius
+	}
+	c.line(`<circle cx="%d" cy="%d" r="%d" %s/>`, center.X, center.Y, radius, fill(col))
+}
+
+func (c *Canvas) Rect(corner fxcanvas.Point, angle int64, col fxcanvas.Color) {
+	rotate := ""
+	if angle%360 != 0 {
+		rotate = fmt.Sprintf(` transform="rotate(%d %d %d)"`, angle%360, corner.X, corner.Y)
+	}
+	c.line(`<rect x="%d" y="%d" width="%d" height="%d"%s %s/>`,
+		corner.X, corner.Y, fxcanvas.RectSize, fxcanvas.RectSize, rotate, fill(col))
+}
+
+func (c *Canvas) Begin(name string) {
+	if !c.Group {
+		return
+	}
+	c.calls[name]++
+	c.line(`<g id="%s-%d">`, name, c.calls[name])
+	c.depth++
+}
+
+func (c *Canvas) End(name string) {
+	if !c.Group {
+		return
+	}
+	c.depth--
+	c.line(`</g>`)
+}
+
+//WriteTo writes the SVG document with what has been drawn
+func (c *Canvas) WriteTo(w io.Writer) (int64, error) {
+
+	var doc bytes.Buffer
+	fmt.Fprintf(&doc, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		c.Width, c.Height, c.Width, c.Height)
+	doc.Write(c.body.Bytes())
+	doc.WriteString("</svg>\n")
+	return doc.WriteTo(w)
+}
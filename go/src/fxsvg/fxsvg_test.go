@@ -0,0 +1,61 @@
+package fxsvg_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fxinterp"
+	. "fxsvg"
+	"fxtest"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func golden(t *testing.T, c *Canvas, file string) {
+
+	var out bytes.Buffer
+	if _, err := c.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(file, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("output differs from %s:\n%s", file, out.String())
+	}
+}
+
+func runFile(t *testing.T, c *Canvas, file string) {
+
+	src, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := fxinterp.Run(context.Background(), src, file, c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLang(t *testing.T) {
+
+	c := New(100, 100)
+	runFile(t, c, fxtest.LangFile())
+	golden(t, c, "testdata/lang.svg")
+}
+
+func TestGroups(t *testing.T) {
+
+	c := New(100, 100)
+	c.Group = true
+	runFile(t, c, fxtest.LangFile())
+	golden(t, c, "testdata/lang_groups.svg")
+}
@@ -1,30 +1,225 @@
 package fxsym
 
+import (
+	"fmt"
+	"fxlex"
+)
+
+//symbol kinds
+
+type SymKind int
+
+const (
+	SNone SymKind = iota
+	SConst
+	SType
+	SVar
+	SFunc
+	SBuiltin
+)
+
+var symKindNames = map[SymKind]string{
+	SNone:    "none",
+	SConst:   "const",
+	SType:    "type",
+	SVar:     "var",
+	SFunc:    "func",
+	SBuiltin: "builtin",
+}
+
+func (k SymKind) String() string {
+	return symKindNames[k]
+}
+
+//data types
+
+type TypeKind int
+
 const (
-  SNone = iota
-  SKey
-  SStr
-  SConst
-  SType
-  SVar
-  SUnary
-  SBinary
-  SProc
-  SFunc
-  SFCall
+	TNone TypeKind = iota
+	TInt
+	TBool
+	TCoord
+	TRecord
+)
+
+type Type struct {
+	Kind   TypeKind
+	Name   string
+	Fields []*Field //only TCoord and TRecord
+}
+
+type Field struct {
+	Name string
+	Type *Type
+}
+
+var (
+	TypeInt   = &Type{Kind: TInt, Name: "int"}
+	TypeBool  = &Type{Kind: TBool, Name: "bool"}
+	TypeCoord = &Type{Kind: TCoord, Name: "Coord", Fields: []*Field{
+		{Name: "x", Type: TypeInt},
+		{Name: "y", Type: TypeInt},
+	}}
 )
 
+func (t *Type) String() string {
+	if t == nil {
+		return "<nil>"
+	}
+	return t.Name
+}
+
+//Field returns the field of a Coord or record type, or nil
+func (t *Type) Field(name string) *Field {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+//IsRecord tells if the type has fields
+func (t *Type) IsRecord() bool {
+	return t.Kind == TCoord || t.Kind == TRecord
+}
+
+//Param is a parameter in the signature of a function or a builtin
+type Param struct {
+	Name string
+	Type *Type
+}
+
 type Sym struct {
-  name string
-  sType int
-  DataType ∗Type
-  //lex.Place
-  FloatVal float64
-  IntVal int64
-  Expr ∗Expr
-  Prog ∗Prog
-  Body ∗Body
-  Asign ∗Asign
-  Iter ∗Iter
-  val ∗Sym
+	Name string
+	Kind SymKind
+	//data type of consts and vars, the declared type for types
+	Type *Type
+	//signature of funcs and builtins
+	Params []*Param
+	//token where it is declared, the zero Token for the universe
+	Pos     fxlex.Token
+	IntVal  int64
+	BoolVal bool
+}
+
+func (s *Sym) String() string {
+	if !s.Pos.Start.IsValid() {
+		return fmt.Sprintf("%s %s %s", s.Kind, s.Name, s.Type)
+	}
+	return fmt.Sprintf("%s %s %s declared at %s", s.Kind, s.Name, s.Type, s.Pos.Start)
+}
+
+//scope kinds, from outer to inner
+
+type ScopeKind int
+
+const (
+	SUniverse ScopeKind = iota
+	SProgram
+	SFunction
+	SBlock
+)
+
+type Scope struct {
+	Kind  ScopeKind
+	Name  string //function name or the statement for blocks (iter, if)
+	Outer *Scope
+	syms  map[string]*Sym
+	order []*Sym
+}
+
+func NewScope(kind ScopeKind, name string, outer *Scope) *Scope {
+	return &Scope{Kind: kind, Name: name, Outer: outer, syms: map[string]*Sym{}}
+}
+
+//NewUniverse returns the outermost scope, with the builtin types, the
+//bool constants and the builtin procedures
+func NewUniverse() *Scope {
+
+	s := NewScope(SUniverse, "universe", nil)
+	for _, t := range []*Type{TypeInt, TypeBool, TypeCoord} {
+		s.Insert(&Sym{Name: t.Name, Kind: SType, Type: t})
+	}
+	s.Insert(&Sym{Name: "True", Kind: SConst, Type: TypeBool, BoolVal: true})
+	s.Insert(&Sym{Name: "False", Kind: SConst, Type: TypeBool, BoolVal: false})
+	for _, b := range Builtins {
+		s.Insert(b)
+	}
+	return s
+}
+
+//Builtins are the drawing procedures of fx. Colors are 0xTTRRGGBB,
+//TT is the transparency.
+var Builtins = []*Sym{
+	{Name: "circle", Kind: SBuiltin, Params: []*Param{
+		{Name: "p", Type: TypeCoord},
+		{Name: "r", Type: TypeInt},
+		{Name: "color", Type: TypeInt},
+	}},
+	{Name: "rect", Kind: SBuiltin, Params: []*Param{
+		{Name: "p", Type: TypeCoord},
+		{Name: "angle", Type: TypeInt},
+		{Name: "color", Type: TypeInt},
+	}},
+}
+
+//Signature returns the parameters of a func or builtin as they are
+//declared, (Coord p, int r, int color)
+func (s *Sym) Signature() string {
+	sig := "("
+	for i, param := range s.Params {
+		if i > 0 {
+			sig += ", "
+		}
+		sig += param.Type.String() + " " + param.Name
+	}
+	return sig + ")"
+}
+
+//Insert declares sym in s. If the name is already declared in s, sym is
+//not inserted and the previous symbol is returned as dup. If the name
+//is declared in an outer scope, that symbol is returned as shadowed.
+func (s *Scope) Insert(sym *Sym) (dup, shadowed *Sym) {
+
+	if prev, ok := s.syms[sym.Name]; ok {
+		return prev, nil
+	}
+	if s.Outer != nil {
+		shadowed = s.Outer.Lookup(sym.Name)
+	}
+	s.syms[sym.Name] = sym
+	s.order = append(s.order, sym)
+	return nil, shadowed
+}
+
+//Lookup finds name in s or in the scopes around it, nil if undeclared
+func (s *Scope) Lookup(name string) *Sym {
+	for ; s != nil; s = s.Outer {
+		if sym, ok := s.syms[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+//LookupLocal finds name only in s
+func (s *Scope) LookupLocal(name string) *Sym {
+	return s.syms[name]
+}
+
+//Syms returns the symbols declared in s in declaration order
+func (s *Scope) Syms() []*Sym {
+	return s.order
+}
+
+//Func returns the innermost function scope around s, or nil
+func (s *Scope) Func() *Scope {
+	for ; s != nil; s = s.Outer {
+		if s.Kind == SFunction {
+			return s
+		}
+	}
+	return nil
 }
@@ -0,0 +1,81 @@
+package fxsym_test
+
+import (
+	. "fxlex"
+	. "fxsym"
+	"testing"
+)
+
+func TestUniverse(t *testing.T) {
+
+	u := NewUniverse()
+	wanted := map[string]SymKind{
+		"int":    SType,
+		"bool":   SType,
+		"Coord":  SType,
+		"True":   SConst,
+		"False":  SConst,
+		"circle": SBuiltin,
+		"rect":   SBuiltin,
+	}
+	for name, kind := range wanted {
+		sym := u.Lookup(name)
+		if sym == nil || sym.Kind != kind {
+			t.Errorf("%s should be a %s, is %v", name, kind, sym)
+		}
+	}
+	if u.Lookup("Coord").Type != TypeCoord || TypeCoord.Field("y").Type != TypeInt {
+		t.Errorf("bad Coord type")
+	}
+	if u.Lookup("True").Type != TypeBool || !u.Lookup("True").BoolVal {
+		t.Errorf("bad True constant")
+	}
+	if sig := u.Lookup("circle").Signature(); sig != "(Coord p, int r, int color)" {
+		t.Errorf("bad circle signature %s", sig)
+	}
+	if sig := u.Lookup("rect").Signature(); sig != "(Coord p, int angle, int color)" {
+		t.Errorf("bad rect signature %s", sig)
+	}
+}
+
+func TestScopes(t *testing.T) {
+
+	prog := NewScope(SProgram, "", NewUniverse())
+	line := &Sym{Name: "line", Kind: SFunc, Pos: Token{File: "f.fx", Line: 1}}
+	if dup, shadowed := prog.Insert(line); dup != nil || shadowed != nil {
+		t.Errorf("bad insert: %v %v", dup, shadowed)
+	}
+
+	fn := NewScope(SFunction, "line", prog)
+	x := &Sym{Name: "x", Kind: SVar, Type: TypeInt, Pos: Token{File: "f.fx", Line: 1, Start: Position{File: "f.fx", Line: 1, Col: 15}}}
+	fn.Insert(x)
+	x2 := &Sym{Name: "x", Kind: SVar, Type: TypeBool, Pos: Token{File: "f.fx", Line: 2}}
+	if dup, _ := fn.Insert(x2); dup != x {
+		t.Errorf("duplicate not reported: %v", dup)
+	}
+
+	block := NewScope(SBlock, "iter", fn)
+	x3 := &Sym{Name: "x", Kind: SVar, Type: TypeBool, Pos: Token{File: "f.fx", Line: 3}}
+	if dup, shadowed := block.Insert(x3); dup != nil || shadowed != x {
+		t.Errorf("shadowing not reported: %v %v", dup, shadowed)
+	}
+	if _, shadowed := block.Insert(&Sym{Name: "circle", Kind: SVar, Type: TypeInt}); shadowed == nil || shadowed.Kind != SBuiltin {
+		t.Errorf("shadowing of builtin not reported: %v", shadowed)
+	}
+
+	if block.Lookup("x") != x3 || fn.Lookup("x") != x || block.Lookup("line") != line {
+		t.Errorf("bad lookup")
+	}
+	if block.LookupLocal("line") != nil || block.Lookup("nothing") != nil {
+		t.Errorf("bad lookup of undeclared")
+	}
+	if block.Func() != fn || prog.Func() != nil {
+		t.Errorf("bad function scope")
+	}
+	if syms := block.Syms(); len(syms) != 2 || syms[0] != x3 {
+		t.Errorf("bad symbols: %v", syms)
+	}
+	if s := x.String(); s != "var x int declared at f.fx:1:15" {
+		t.Errorf("bad string: %s", s)
+	}
+}
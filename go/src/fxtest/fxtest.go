@@ -0,0 +1,65 @@
+//Package fxtest has the helpers shared by the tests of the fx packages
+package fxtest
+
+import (
+	"bufio"
+	"fmt"
+	"fxlex"
+	"fxparser"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//LangFile is the path of lang.fx, the program with every construct of
+//fx that the tests of all the packages run
+func LangFile() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata", "lang.fx")
+}
+
+//Lang returns the source of lang.fx
+func Lang(t testing.TB) string {
+
+	t.Helper()
+	src, err := os.ReadFile(LangFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(src)
+}
+
+//Parse parses and checks the fx program in text, filename is used in
+//the error messages. The test fails if the program has errors.
+func Parse(t testing.TB, filename string, text string) *fxparser.Program {
+
+	t.Helper()
+	p := fxparser.NewParser(fxlex.NewLexer(bufio.NewReader(strings.NewReader(text)), filename))
+	p.DebugDesc = false
+	prog, errs := p.Parse()
+	if errs != nil {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	return prog
+}
+
+//Chain returns a program where main calls f1, f1 calls f2 ... fn,
+//each call made ncalls times
+func Chain(n int, ncalls int) string {
+
+	var b strings.Builder
+	for i := n; i > 0; i-- {
+		fmt.Fprintf(&b, "func f%d(){\n", i)
+		if i == n {
+			b.WriteString("  circle([1, 2], 3, 4);\n")
+		}
+		for j := 0; j < ncalls && i < n; j++ {
+			fmt.Fprintf(&b, "  f%d();\n", i+1)
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("func main(){\n  f1();\n}\n")
+	return b.String()
+}
@@ -0,0 +1,288 @@
+package fxvm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"fxlex"
+	"fxparser"
+	"fxsym"
+)
+
+//Program is the bytecode of an fx program
+type Program struct {
+	Funcs  []*Func
+	Main   int //index of main in Funcs
+	Consts []int64
+}
+
+type Func struct {
+	Name    string
+	Tok     fxlex.Token
+	NParams int //slots taken by the parameters, the first ones
+	NSlots  int //slots of the parameters and the locals
+	Code    []byte
+	//position of the instructions that can fail at run time
+	Pos map[int]fxlex.Token
+}
+
+type compiler struct {
+	prog   *fxparser.Program
+	out    *Program
+	funcs  map[*fxsym.Sym]int
+	consts map[int64]int
+	fn     *Func
+	slots  map[*fxsym.Sym]int
+}
+
+//Compile translates a program without errors, as returned by
+//fxparser.Parse. main must be declared and have no parameters.
+func Compile(prog *fxparser.Program) (*Program, error) {
+
+	main := prog.Func("main")
+	if main == nil {
+		return nil, errors.New(prog.Tok.File + ": No function main")
+	}
+	if len(main.Params) != 0 {
+		return nil, fmt.Errorf("%s: Function main has parameters", main.Tok.Start)
+	}
+
+	c := &compiler{prog: prog, out: &Program{}, funcs: map[*fxsym.Sym]int{}, consts: map[int64]int{}}
+	for i, fn := range prog.Funcs {
+		c.funcs[fn.Sym] = i
+		if fn == main {
+			c.out.Main = i
+		}
+	}
+	for _, fn := range prog.Funcs {
+		c.out.Funcs = append(c.out.Funcs, c.compileFunc(fn))
+	}
+	return c.out, nil
+}
+
+//size is the number of slots taken by a value of type t
+func size(t *fxsym.Type) int {
+	if !t.IsRecord() {
+		return 1
+	}
+	n := 0
+	for _, f := range t.Fields {
+		n += size(f.Type)
+	}
+	return n
+}
+
+//offset returns the first slot of the field in a value of type t and
+//the type of the field
+func offset(t *fxsym.Type, name string) (int, *fxsym.Type) {
+	off := 0
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return off, f.Type
+		}
+		off += size(f.Type)
+	}
+	panic("no field " + name + " in " + t.Name)
+}
+
+func (c *compiler) emit(op Opcode, args ...int) int {
+	pc := len(c.fn.Code)
+	c.fn.Code = append(c.fn.Code, byte(op))
+	for _, a := range args {
+		c.fn.Code = binary.LittleEndian.AppendUint32(c.fn.Code, uint32(int32(a)))
+	}
+	return pc
+}
+
+//emitAt is emit for the instructions that can fail, tok is where
+func (c *compiler) emitAt(tok fxlex.Token, op Opcode, args ...int) int {
+	pc := c.emit(op, args...)
+	c.fn.Pos[pc] = tok
+	return pc
+}
+
+//patch sets the operand i of the instruction at pc to the current end
+//of the code, for forward jumps
+func (c *compiler) patch(pc int, i int) {
+	binary.LittleEndian.PutUint32(c.fn.Code[pc+1+4*i:], uint32(len(c.fn.Code)))
+}
+
+func (c *compiler) constant(v int64) int {
+	if k, ok := c.consts[v]; ok {
+		return k
+	}
+	c.consts[v] = len(c.out.Consts)
+	c.out.Consts = append(c.out.Consts, v)
+	return c.consts[v]
+}
+
+//alloc returns n new slots in the function
+func (c *compiler) alloc(n int) int {
+	slot := c.fn.NSlots
+	c.fn.NSlots += n
+	return slot
+}
+
+func (c *compiler) compileFunc(decl *fxparser.FuncDecl) *Func {
+
+	c.fn = &Func{Name: decl.Name, Tok: decl.Tok, Pos: map[int]fxlex.Token{}}
+	c.slots = map[*fxsym.Sym]int{}
+	for _, param := range decl.Params {
+		c.slots[param.Sym] = c.alloc(size(param.Sym.Type))
+	}
+	c.fn.NParams = c.fn.NSlots
+	c.block(decl.Body)
+	c.emit(OpRet)
+	return c.fn
+}
+
+func (c *compiler) block(block *fxparser.Block) {
+	for _, stmt := range block.Stmts {
+		c.stmt(stmt)
+	}
+}
+
+func (c *compiler) stmt(stmt fxparser.Stmt) {
+
+	switch stmt := stmt.(type) {
+	case *fxparser.VarDecl:
+		n := size(stmt.Sym.Type)
+		c.slots[stmt.Sym] = c.alloc(n)
+		c.emit(OpZero, c.slots[stmt.Sym], n)
+	case *fxparser.AssignStmt:
+		c.expr(stmt.Value)
+		slot, t := c.path(stmt.Target)
+		c.emit(OpStore, slot, size(t))
+	case *fxparser.CallStmt:
+		for _, arg := range stmt.Args {
+			c.expr(arg)
+		}
+		switch {
+		case stmt.Sym.Kind == fxsym.SFunc:
+			c.emitAt(stmt.Tok, OpCall, c.funcs[stmt.Sym])
+		case stmt.Name == "circle":
+			c.emit(OpCircle)
+		case stmt.Name == "rect":
+			c.emit(OpRect)
+		}
+	case *fxparser.IterStmt:
+		c.iter(stmt)
+	case *fxparser.IfStmt:
+		c.expr(stmt.Cond)
+		jmpElse := c.emit(OpJmpFalse, 0)
+		c.block(stmt.Then)
+		if stmt.Else == nil {
+			c.patch(jmpElse, 0)
+			return
+		}
+		jmpEnd := c.emit(OpJmp, 0)
+		c.patch(jmpElse, 0)
+		c.stmt(stmt.Else)
+		c.patch(jmpEnd, 0)
+	case *fxparser.Block:
+		c.block(stmt)
+	}
+}
+
+//iter keeps the bound and the step in hidden slots, they are evaluated
+//once like in the interpreter
+func (c *compiler) iter(stmt *fxparser.IterStmt) {
+
+	i := c.alloc(1)
+	c.slots[stmt.Var.Sym] = i
+	end, step := c.alloc(1), c.alloc(1)
+	c.expr(stmt.Start)
+	c.emit(OpStore, i, 1)
+	c.expr(stmt.End)
+	c.emit(OpStore, end, 1)
+	c.expr(stmt.Step)
+	c.emit(OpStore, step, 1)
+	c.emitAt(stmt.Step.Token(), OpIterChk, step)
+
+	top := c.emit(OpIterTest, i, end, step, 0)
+	c.block(stmt.Body)
+	c.emit(OpIterNext, i, step, top)
+	c.patch(top, 3)
+}
+
+//path returns the slot and the type of a variable or of a field of a
+//variable
+func (c *compiler) path(expr fxparser.Expr) (int, *fxsym.Type) {
+
+	switch expr := expr.(type) {
+	case *fxparser.Ident:
+		return c.slots[expr.Sym], expr.Sym.Type
+	case *fxparser.SelectorExpr:
+		slot, t := c.path(expr.X)
+		if slot < 0 {
+			return -1, nil
+		}
+		off, ft := offset(t, expr.Sel.Name)
+		return slot + off, ft
+	}
+	return -1, nil
+}
+
+var binOps = map[fxlex.TokType]Opcode{
+	fxlex.TokType('+'): OpAdd,
+	fxlex.TokType('-'): OpSub,
+	fxlex.TokType('*'): OpMul,
+	fxlex.TokType('/'): OpDiv,
+	fxlex.TokType('%'): OpMod,
+	fxlex.TokDMul:      OpPow,
+	fxlex.TokType('<'): OpLt,
+	fxlex.TokType('>'): OpGt,
+	fxlex.TokSmaller:   OpLe,
+	fxlex.TokGreater:   OpGe,
+	fxlex.TokEqual:     OpEq,
+	fxlex.TokType('&'): OpAnd,
+	fxlex.TokType('|'): OpOr,
+	fxlex.TokType('^'): OpXor,
+}
+
+//expr pushes the slots of the value of the expression
+func (c *compiler) expr(expr fxparser.Expr) {
+
+	switch expr := expr.(type) {
+	case *fxparser.IntLit:
+		c.emit(OpConst, c.constant(expr.Value))
+	case *fxparser.BoolLit:
+		v := int64(0)
+		if expr.Value {
+			v = 1
+		}
+		c.emit(OpConst, c.constant(v))
+	case *fxparser.Ident:
+		c.emit(OpLoad, c.slots[expr.Sym], size(expr.Sym.Type))
+	case *fxparser.CoordLit:
+		c.expr(expr.X)
+		c.expr(expr.Y)
+	case *fxparser.SelectorExpr:
+		if slot, t := c.path(expr); slot >= 0 {
+			c.emit(OpLoad, slot, size(t))
+			return
+		}
+		//a field of a value that is not in a variable, [1, 2].x
+		xt := c.prog.TypeOf(expr.X)
+		off, ft := offset(xt, expr.Sel.Name)
+		c.expr(expr.X)
+		c.emit(OpField, size(xt), off, size(ft))
+	case *fxparser.UnaryExpr:
+		c.expr(expr.X)
+		switch expr.Op {
+		case fxlex.TokType('-'):
+			c.emit(OpNeg)
+		case fxlex.TokType('!'):
+			c.emit(OpNot)
+		}
+	case *fxparser.BinaryExpr:
+		c.expr(expr.X)
+		c.expr(expr.Y)
+		switch op := binOps[expr.Op]; op {
+		case OpDiv, OpMod, OpPow:
+			c.emitAt(expr.Tok, op)
+		default:
+			c.emit(op)
+		}
+	}
+}
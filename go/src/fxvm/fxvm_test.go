@@ -0,0 +1,166 @@
+package fxvm_test
+
+import (
+	"bytes"
+	"context"
+	"fxcanvas"
+	"fxinterp"
+	"fxtest"
+	. "fxvm"
+	"strings"
+	"testing"
+)
+
+//runBoth runs the program in the interpreter and in the VM and checks
+//they draw the same and fail the same
+func runBoth(t *testing.T, text string) []string {
+
+	prog := fxtest.Parse(t, "vm_test.fx", text)
+	want := &fxcanvas.Recorder{}
+	wantErr := fxinterp.New(prog, want).Run(context.Background())
+
+	got := &fxcanvas.Recorder{}
+	code, err := Compile(prog)
+	if err == nil {
+		err = New(code, got).Run(context.Background())
+	}
+	if (err == nil) != (wantErr == nil) || (err != nil && err.Error() != wantErr.Error()) {
+		t.Errorf("vm error is %v, interpreter error is %v", err, wantErr)
+	}
+	if strings.Join(got.Strings(), "\n") != strings.Join(want.Strings(), "\n") {
+		t.Errorf("vm drew\n\t%s\ninterpreter drew\n\t%s",
+			strings.Join(got.Strings(), "\n\t"), strings.Join(want.Strings(), "\n\t"))
+	}
+	return got.Strings()
+}
+
+func TestSameAsInterp(t *testing.T) {
+
+	programs := []string{
+		fxtest.Lang(t),
+		"type record seg(Coord a, Coord b)\n" +
+			"func move(seg s, int n){\n" +
+			"  s.a.x = 100;\n" +
+			"  n = 0;\n" +
+			"  circle(s.a, n, 0);\n" +
+			"}\n" +
+			"func main(){\n" +
+			"  seg s;\n" +
+			"  seg t;\n" +
+			"  int n;\n" +
+			"  n = 5;\n" +
+			"  s.a = [1, 2];\n" +
+			"  t = s;\n" +
+			"  t.a.y = 7;\n" +
+			"  move(s, n);\n" +
+			"  circle(s.a, n, 0);\n" +
+			"  rect(t.a, n, 0);\n" +
+			"  rect(t.b, -n ** 2 % 7, [n, n * 2].y);\n" +
+			"}\n",
+		"func main(){\n" +
+			"  bool b;\n" +
+			"  iter (i := 5; 1, -2){\n" +
+			"    b = !b ^ (i == 3) & True;\n" +
+			"    if (b) {\n" +
+			"      circle([i, 0], 1, 0);\n" +
+			"    } else if (i >= 3 | i <= -1) {\n" +
+			"      rect([i, i / 2], 1, 1);\n" +
+			"    } else {\n" +
+			"      circle([i, 0 - i], i * i, 2);\n" +
+			"    }\n" +
+			"  }\n" +
+			"  iter (i := 0; 10, 3){\n" +
+			"    int k;\n" +
+			"    if (i == 3) {\n" +
+			"      i = 8;\n" +
+			"    } else if (i > 8) {\n" +
+			"      k = 1;\n" +
+			"    }\n" +
+			"    circle([i, k], 1, 0);\n" +
+			"  }\n" +
+			"}\n",
+		"func main(){\n  int z;\n  circle([1, 1], 1, 0);\n  circle([1, 1], 1 % z, 0);\n}\n",
+		"func main(){\n  iter (i := 0; 3, 1 - 1){\n    circle([i, i], 1, 0);\n  }\n}\n",
+		fxtest.Chain(fxinterp.MaxDepth, 1),
+		"func f(){\n  circle([1, 1], 1, 0);\n}\n",
+	}
+	for _, text := range programs {
+		runBoth(t, text)
+	}
+}
+
+func TestDisasm(t *testing.T) {
+
+	code, err := Compile(fxtest.Parse(t, "vm_test.fx", "func f(Coord p){\n"+
+		"  iter (i := 0; p.x, 1){\n"+
+		"    circle(p, i / 2, 3);\n"+
+		"  }\n"+
+		"}\n"+
+		"func main(){\n"+
+		"  f([7, 1]);\n"+
+		"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := code.Disasm(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const want = "func f: 2 params, 5 slots\n" +
+		"0000\tCONST   \t0\t; 0\n" +
+		"0005\tSTORE   \t2 1\n" +
+		"0014\tLOAD    \t0 1\n" +
+		"0023\tSTORE   \t3 1\n" +
+		"0032\tCONST   \t1\t; 1\n" +
+		"0037\tSTORE   \t4 1\n" +
+		"0046\tITERCHK \t4\n" +
+		"0051\tITERTEST\t2 3 4 111\n" +
+		"0068\tLOAD    \t0 2\n" +
+		"0077\tLOAD    \t2 1\n" +
+		"0086\tCONST   \t2\t; 2\n" +
+		"0091\tDIV\n" +
+		"0092\tCONST   \t3\t; 3\n" +
+		"0097\tCIRCLE\n" +
+		"0098\tITERNEXT\t2 4 51\n" +
+		"0111\tRET\n" +
+		"\n" +
+		"func main: 0 params, 0 slots\n" +
+		"0000\tCONST   \t4\t; 7\n" +
+		"0005\tCONST   \t1\t; 1\n" +
+		"0010\tCALL    \t0\t; f\n" +
+		"0015\tRET\n"
+	if buf.String() != want {
+		t.Errorf("disassembly is\n%s\nshould be\n%s", buf.String(), want)
+	}
+}
+
+const benchText = "func main(){\n" +
+	"  Coord p;\n" +
+	"  iter (i := 0; 100000, 1){\n" +
+	"    p = [i % 640, i / 640];\n" +
+	"    circle(p, 2, i);\n" +
+	"  }\n" +
+	"}\n"
+
+type nopCanvas struct{}
+
+func (nopCanvas) Circle(fxcanvas.Point, int64, fxcanvas.Color) {}
+func (nopCanvas) Rect(fxcanvas.Point, int64, fxcanvas.Color)   {}
+
+func BenchmarkVM(b *testing.B) {
+	code, err := Compile(fxtest.Parse(b, "vm_test.fx", benchText))
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm := New(code, nopCanvas{})
+	for i := 0; i < b.N; i++ {
+		vm.Run(context.Background())
+	}
+}
+
+func BenchmarkInterp(b *testing.B) {
+	in := fxinterp.New(fxtest.Parse(b, "vm_test.fx", benchText), nopCanvas{})
+	for i := 0; i < b.N; i++ {
+		in.Run(context.Background())
+	}
+}
@@ -0,0 +1,144 @@
+package fxvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//Every value in the VM is an int64, bools are 0 or 1. Records (and
+//Coord) are flattened: a record of type T takes size(T) consecutive
+//slots, its fields in order, so a Coord is x and then y. Passing and
+//assigning a record copies its slots.
+//
+//An instruction is an opcode byte followed by its operands, each one a
+//little endian int32.
+
+type Opcode byte
+
+const (
+	OpConst Opcode = iota //k: push Consts[k]
+	OpLoad                //slot n: push the n locals from slot
+	OpStore               //slot n: pop n values into the locals from slot
+	OpZero                //slot n: set the n locals from slot to 0
+	OpField               //n off size: leave size of the top n values, from off
+	OpNeg                 //x: -x
+	OpNot                 //b: !b
+	OpAdd                 //x y: x + y, and so on
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpLt
+	OpGt
+	OpLe
+	OpGe
+	OpEq
+	OpAnd
+	OpOr
+	OpXor
+	OpJmp      //addr: jump to addr
+	OpJmpFalse //addr: pop b, jump to addr if it is 0
+	OpIterChk  //step: fail if the local step is 0
+	OpIterTest //i end step addr: jump to addr if i is past end
+	OpIterNext //i step addr: i += step and jump to addr, fall through on overflow
+	OpCall     //f: call Funcs[f], the arguments are on the stack
+	OpRet      //return from the function
+	OpCircle   //x y r color: draw a circle
+	OpRect     //x y angle color: draw a rect
+)
+
+type opInfo struct {
+	name  string
+	nargs int
+}
+
+var opTab = []opInfo{
+	OpConst:    {"CONST", 1},
+	OpLoad:     {"LOAD", 2},
+	OpStore:    {"STORE", 2},
+	OpZero:     {"ZERO", 2},
+	OpField:    {"FIELD", 3},
+	OpNeg:      {"NEG", 0},
+	OpNot:      {"NOT", 0},
+	OpAdd:      {"ADD", 0},
+	OpSub:      {"SUB", 0},
+	OpMul:      {"MUL", 0},
+	OpDiv:      {"DIV", 0},
+	OpMod:      {"MOD", 0},
+	OpPow:      {"POW", 0},
+	OpLt:       {"LT", 0},
+	OpGt:       {"GT", 0},
+	OpLe:       {"LE", 0},
+	OpGe:       {"GE", 0},
+	OpEq:       {"EQ", 0},
+	OpAnd:      {"AND", 0},
+	OpOr:       {"OR", 0},
+	OpXor:      {"XOR", 0},
+	OpJmp:      {"JMP", 1},
+	OpJmpFalse: {"JMPF", 1},
+	OpIterChk:  {"ITERCHK", 1},
+	OpIterTest: {"ITERTEST", 4},
+	OpIterNext: {"ITERNEXT", 3},
+	OpCall:     {"CALL", 1},
+	OpRet:      {"RET", 0},
+	OpCircle:   {"CIRCLE", 0},
+	OpRect:     {"RECT", 0},
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opTab) {
+		return opTab[op].name
+	}
+	return fmt.Sprintf("OP%d", byte(op))
+}
+
+//size of the instruction with its operands
+func (op Opcode) size() int {
+	return 1 + 4*opTab[op].nargs
+}
+
+func arg(code []byte, pc int, i int) int {
+	return int(int32(binary.LittleEndian.Uint32(code[pc+1+4*i:])))
+}
+
+//Disasm writes the code of every function, one instruction per line
+func (p *Program) Disasm(w io.Writer) error {
+
+	for i, fn := range p.Funcs {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "func %s: %d params, %d slots\n", fn.Name, fn.NParams, fn.NSlots)
+		if err != nil {
+			return err
+		}
+		for pc := 0; pc < len(fn.Code); pc += Opcode(fn.Code[pc]).size() {
+			if _, err := fmt.Fprintln(w, p.instr(fn, pc)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Program) instr(fn *Func, pc int) string {
+
+	op := Opcode(fn.Code[pc])
+	args := []string{}
+	for i := 0; i < opTab[op].nargs; i++ {
+		args = append(args, fmt.Sprint(arg(fn.Code, pc, i)))
+	}
+	s := fmt.Sprintf("%04d\t%-8s\t%s", pc, op, strings.Join(args, " "))
+	switch op {
+	case OpConst:
+		s += fmt.Sprintf("\t; %d", p.Consts[arg(fn.Code, pc, 0)])
+	case OpCall:
+		s += "\t; " + p.Funcs[arg(fn.Code, pc, 0)].Name
+	}
+	return strings.TrimRight(s, "\t ")
+}
@@ -0,0 +1,232 @@
+package fxvm
+
+import (
+	"context"
+	"fmt"
+	"fxcanvas"
+	"fxinterp"
+)
+
+//VM runs a Program drawing on a canvas. It draws the same as the
+//interpreter (fxinterp) and fails with the same errors.
+
+type frame struct {
+	fn   *Func
+	pc   int //where to return in fn
+	base int //first local of fn
+}
+
+type VM struct {
+	prog   *Program
+	canvas fxcanvas.Canvas
+	stack  []int64
+	locals []int64
+	frames []frame
+}
+
+func New(prog *Program, canvas fxcanvas.Canvas) *VM {
+	return &VM{prog: prog, canvas: canvas}
+}
+
+//checkEvery is how many iterations run between checks of the context
+const checkEvery = 1024
+
+func (vm *VM) errAt(fn *Func, pc int, message string) error {
+	tok := fn.Pos[pc]
+	return fmt.Errorf("%s: %s", tok.Start, message)
+}
+
+func (vm *VM) push(v int64) {
+	vm.stack = append(vm.stack, v)
+}
+
+func (vm *VM) pop() int64 {
+	v := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return v
+}
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//call starts fn, its arguments are the top of the stack
+func (vm *VM) call(fn *Func) {
+	if g, ok := vm.canvas.(fxcanvas.Grouper); ok {
+		g.Begin(fn.Name)
+	}
+	base := len(vm.locals)
+	vm.locals = append(vm.locals, make([]int64, fn.NSlots)...)
+	args := vm.stack[len(vm.stack)-fn.NParams:]
+	copy(vm.locals[base:], args)
+	vm.stack = vm.stack[:len(vm.stack)-fn.NParams]
+	vm.frames = append(vm.frames, frame{fn: fn, base: base})
+}
+
+//Run executes main
+func (vm *VM) Run(ctx context.Context) error {
+
+	vm.stack, vm.locals, vm.frames = vm.stack[:0], vm.locals[:0], vm.frames[:0]
+	err := vm.run(ctx)
+	//close the groups of the calls stopped by an error
+	if g, ok := vm.canvas.(fxcanvas.Grouper); ok {
+		for i := len(vm.frames) - 1; i >= 0; i-- {
+			g.End(vm.frames[i].fn.Name)
+		}
+	}
+	return err
+}
+
+func (vm *VM) run(ctx context.Context) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	vm.call(vm.prog.Funcs[vm.prog.Main])
+
+	fr := &vm.frames[len(vm.frames)-1]
+	fn, code, pc := fr.fn, fr.fn.Code, 0
+	loops := 0
+	for {
+		op := Opcode(code[pc])
+		next := pc + op.size()
+
+		switch op {
+		case OpConst:
+			vm.push(vm.prog.Consts[arg(code, pc, 0)])
+		case OpLoad:
+			slot := fr.base + arg(code, pc, 0)
+			vm.stack = append(vm.stack, vm.locals[slot:slot+arg(code, pc, 1)]...)
+		case OpStore:
+			slot, n := fr.base+arg(code, pc, 0), arg(code, pc, 1)
+			copy(vm.locals[slot:slot+n], vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+		case OpZero:
+			slot, n := fr.base+arg(code, pc, 0), arg(code, pc, 1)
+			for i := slot; i < slot+n; i++ {
+				vm.locals[i] = 0
+			}
+		case OpField:
+			n, off, size := arg(code, pc, 0), arg(code, pc, 1), arg(code, pc, 2)
+			top := len(vm.stack) - n
+			copy(vm.stack[top:], vm.stack[top+off:top+off+size])
+			vm.stack = vm.stack[:top+size]
+		case OpNeg:
+			vm.stack[len(vm.stack)-1] = -vm.stack[len(vm.stack)-1]
+		case OpNot:
+			vm.stack[len(vm.stack)-1] ^= 1
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpLt, OpGt, OpLe, OpGe, OpEq, OpAnd, OpOr, OpXor:
+			y := vm.pop()
+			x := vm.pop()
+			var r int64
+			switch op {
+			case OpAdd:
+				r = x + y
+			case OpSub:
+				r = x - y
+			case OpMul:
+				r = x * y
+			case OpDiv, OpMod:
+				if y == 0 {
+					return vm.errAt(fn, pc, "Division by zero")
+				}
+				if op == OpDiv {
+					r = x / y
+				} else {
+					r = x % y
+				}
+			case OpPow:
+				if y < 0 {
+					return vm.errAt(fn, pc, "Negative exponent")
+				}
+				r = fxinterp.Pow(x, y)
+			case OpLt:
+				r = b2i(x < y)
+			case OpGt:
+				r = b2i(x > y)
+			case OpLe:
+				r = b2i(x <= y)
+			case OpGe:
+				r = b2i(x >= y)
+			case OpEq:
+				r = b2i(x == y)
+			case OpAnd:
+				r = x & y
+			case OpOr:
+				r = x | y
+			case OpXor:
+				r = x ^ y
+			}
+			vm.push(r)
+		case OpJmp:
+			next = arg(code, pc, 0)
+		case OpJmpFalse:
+			if vm.pop() == 0 {
+				next = arg(code, pc, 0)
+			}
+		case OpIterChk:
+			if vm.locals[fr.base+arg(code, pc, 0)] == 0 {
+				return vm.errAt(fn, pc, "Iter step is 0")
+			}
+		case OpIterTest:
+			i := vm.locals[fr.base+arg(code, pc, 0)]
+			end := vm.locals[fr.base+arg(code, pc, 1)]
+			step := vm.locals[fr.base+arg(code, pc, 2)]
+			if (step > 0 && i > end) || (step < 0 && i < end) {
+				next = arg(code, pc, 3)
+				break
+			}
+			if loops++; loops%checkEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+		case OpIterNext:
+			i, step := &vm.locals[fr.base+arg(code, pc, 0)], vm.locals[fr.base+arg(code, pc, 1)]
+			//on overflow the loop ends
+			if n := *i + step; (step > 0) == (n > *i) {
+				*i = n
+				next = arg(code, pc, 2)
+			}
+		case OpCall:
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			callee := vm.prog.Funcs[arg(code, pc, 0)]
+			if len(vm.frames) >= fxinterp.MaxDepth {
+				return vm.errAt(fn, pc, "Too many nested calls to "+callee.Name)
+			}
+			fr.pc = next
+			vm.call(callee)
+			fr = &vm.frames[len(vm.frames)-1]
+			fn, code, next = fr.fn, fr.fn.Code, 0
+		case OpRet:
+			if g, ok := vm.canvas.(fxcanvas.Grouper); ok {
+				g.End(fn.Name)
+			}
+			vm.locals = vm.locals[:fr.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == 0 {
+				return nil
+			}
+			fr = &vm.frames[len(vm.frames)-1]
+			fn, code, next = fr.fn, fr.fn.Code, fr.pc
+		case OpCircle, OpRect:
+			col := fxcanvas.Color(vm.pop())
+			n := vm.pop()
+			y := vm.pop()
+			x := vm.pop()
+			if op == OpCircle {
+				vm.canvas.Circle(fxcanvas.Point{X: x, Y: y}, n, col)
+			} else {
+				vm.canvas.Rect(fxcanvas.Point{X: x, Y: y}, n, col)
+			}
+		default:
+			return fmt.Errorf("bad opcode %d in %s at %d", op, fn.Name, pc)
+		}
+		pc = next
+	}
+}